@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// abSignificance is the p-value below which an A/B difference is reported
+// as significant.
+const abSignificance = 0.05
+
+// abSide is one side of an A/B comparison: a host, optionally over a
+// transport other than -transport.
+type abSide struct {
+	label     string
+	host      string
+	transport string
+}
+
+// parseABSides parses "a,b" where each side is host or host/transport,
+// e.g. "stun.example.net:3478/udp,stun.example.net:3478/tcp".
+func parseABSides(s, transport string) ([2]abSide, error) {
+	var sides [2]abSide
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return sides, fmt.Errorf("invalid -compare %q (want a,b with each side host or host/transport)", s)
+	}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		host, t, ok := strings.Cut(part, "/")
+		if !ok {
+			t = transport
+		}
+		sides[i] = abSide{label: part, host: host, transport: t}
+	}
+	return sides, nil
+}
+
+// mannWhitney returns the Mann-Whitney U statistic of a against b and the
+// two-sided p-value from its normal approximation, corrected for ties and
+// continuity. The test makes no assumption about the shape of the
+// distributions, which for RTTs are rarely normal.
+func mannWhitney(a, b []int64) (u, p float64) {
+	type sample struct {
+		value int64
+		fromA bool
+	}
+	all := make([]sample, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Tied values share the mean of their ranks.
+	var rankSumA, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u = rankSumA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / sigma
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+// runABCompare measures two hosts or transports with interleaved requests,
+// so that changing network conditions affect both sides alike, and tests
+// whether their RTTs differ significantly.
+func runABCompare(cfg config) error {
+	sides, err := parseABSides(cfg.abCompare, cfg.transport)
+	if err != nil {
+		return err
+	}
+
+	var probers [2]*prober
+	for i, side := range sides {
+		sideCfg := cfg
+		sideCfg.transport = side.transport
+		p, err := newProber(sideCfg, side.host)
+		if err != nil {
+			return fmt.Errorf("%s: %w", side.label, err)
+		}
+		defer p.Close()
+		probers[i] = p
+	}
+
+	probeCfg := cfg
+	probeCfg.runCount = 1
+	probeCfg.duration = 0
+	probeCfg.quiet = true
+
+	out := cfg.logOutput()
+	fmt.Fprintf(out, "A: %s\nB: %s\n", sides[0].label, sides[1].label)
+	fmt.Fprintln(out, "Starting interleaved STUN requests...")
+	bar := cfg.progressBar(2 * cfg.runCount)
+	var results [2][]result
+	for i := 0; i < cfg.runCount; i++ {
+		// Alternate which side goes first, so neither always follows the
+		// other.
+		order := []int{0, 1}
+		if i%2 == 1 {
+			order = []int{1, 0}
+		}
+		for _, side := range order {
+			r, err := probers[side].run(probeCfg)
+			if err != nil {
+				return fmt.Errorf("%s: %w", sides[side].label, err)
+			}
+			for _, res := range r {
+				res.index = len(results[side])
+				results[side] = append(results[side], res)
+			}
+			bar.Add(1)
+		}
+	}
+	fmt.Fprintln(out)
+
+	// Each side's first request set up its socket; leave it out.
+	for i := range results {
+		if len(results[i]) > 0 {
+			results[i] = results[i][1:]
+		}
+	}
+	fmt.Println()
+	printComparison([]comparisonRow{
+		{label: "A: " + sides[0].label, results: results[0]},
+		{label: "B: " + sides[1].label, results: results[1]},
+	})
+
+	a, b := sortedSuccessfulTimes(results[0]), sortedSuccessfulTimes(results[1])
+	if len(a) < 2 || len(b) < 2 {
+		return errors.New("not enough successful requests on both sides to compare")
+	}
+	medianA, medianB := percentile(a, 50), percentile(b, 50)
+	u, p := mannWhitney(a, b)
+	fmt.Printf("\nMedian difference (B - A): %+d μs (%+.1f%%)\n", medianB-medianA, float64(medianB-medianA)/float64(medianA)*100)
+	fmt.Printf("Mann-Whitney U = %.0f, p = %.4g\n", u, p)
+	// U counts the pairs in which A's RTT is the larger, ties counting half.
+	fmt.Printf("Chance a request to A is faster than one to B: %.0f%%\n", (1-u/float64(len(a)*len(b)))*100)
+	if p < abSignificance {
+		fmt.Printf("The difference is statistically significant (p < %g)\n", abSignificance)
+	} else {
+		fmt.Printf("The difference is not statistically significant (p ≥ %g); it may be noise\n", abSignificance)
+	}
+	return nil
+}
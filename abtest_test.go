@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int64
+		u, p float64
+	}{
+		{"separated", []int64{1, 2, 3}, []int64{4, 5, 6}, 0, 0.080856},
+		{"reversed", []int64{4, 5, 6}, []int64{1, 2, 3}, 9, 0.080856},
+		{"ties", []int64{1, 2, 2, 3}, []int64{2, 3, 4, 5}, 2.5, 0.136658},
+		{"unequal sizes", []int64{19, 22, 16, 29, 24}, []int64{20, 11, 17, 12}, 17, 0.111347},
+		{"identical", []int64{7, 7, 7}, []int64{7, 7, 7}, 4.5, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, p := mannWhitney(tt.a, tt.b)
+			if u != tt.u {
+				t.Errorf("U = %v, want %v", u, tt.u)
+			}
+			if math.Abs(p-tt.p) > 1e-5 {
+				t.Errorf("p = %v, want %v", p, tt.p)
+			}
+		})
+	}
+}
+
+func TestParseABSides(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    [2]abSide
+		wantErr bool
+	}{
+		{
+			in: "a.example:3478,b.example:3478",
+			want: [2]abSide{
+				{label: "a.example:3478", host: "a.example:3478", transport: "udp"},
+				{label: "b.example:3478", host: "b.example:3478", transport: "udp"},
+			},
+		},
+		{
+			in: "s.example:3478/udp, s.example:3478/tcp",
+			want: [2]abSide{
+				{label: "s.example:3478/udp", host: "s.example:3478", transport: "udp"},
+				{label: "s.example:3478/tcp", host: "s.example:3478", transport: "tcp"},
+			},
+		},
+		{in: "only-one", wantErr: true},
+		{in: "a,b,c", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseABSides(tt.in, "udp")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseABSides(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseABSides(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
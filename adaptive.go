@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func sortedSuccessfulTimes(results []result) []int64 {
+	var times []int64
+	for _, r := range results {
+		if r.err == nil {
+			times = append(times, r.time)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times
+}
+
+// autoMaxRuns caps an -auto run whose -runs was left at its default.
+const autoMaxRuns = 100_000
+
+// estimatesConverged reports whether the 95% CI of each of the given
+// percentiles is narrower than target, expressed as a fraction of the
+// percentile.
+func estimatesConverged(results []result, target float64, percentiles []float64) bool {
+	times := sortedSuccessfulTimes(results)
+	if len(times) < 2 {
+		return false
+	}
+	for _, p := range percentiles {
+		lo, hi, bounded := percentileCI(times, p)
+		estimate := percentile(times, p)
+		if !bounded || estimate <= 0 || float64(hi-lo)/float64(estimate) > target {
+			return false
+		}
+	}
+	return true
+}
+
+func printAdaptiveSummary(cfg config, results []result) {
+	times := sortedSuccessfulTimes(results)
+	if len(times) == 0 {
+		return
+	}
+
+	if len(results) < cfg.runCount || estimatesConverged(results, cfg.adaptiveTarget, cfg.adaptivePercentiles) {
+		fmt.Printf("\nAdaptive stop: converged after %d samples\n", len(results))
+	} else {
+		fmt.Printf("\nAdaptive stop: did not converge within %d samples\n", len(results))
+	}
+	for _, p := range cfg.adaptivePercentiles {
+		lo, hi, bounded := percentileCI(times, p)
+		label := percentileLabel(p)
+		if p == 50 {
+			label = "Median"
+		}
+		if !bounded {
+			fmt.Printf("%s 95%% CI: too few samples\n", label)
+			continue
+		}
+		fmt.Printf("%s 95%% CI: %d - %d μs (width %.1f%% of %s)\n",
+			label, lo, hi, float64(hi-lo)/float64(percentile(times, p))*100, strings.ToLower(label))
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// runAsyncRequests sends requests every cfg.sendInterval without waiting for
+// the previous response, matching responses to requests by transaction ID.
+// Unlike runSTUNRequests it allows several transactions in flight, so it can
+// observe reordering.
+//
+// With cfg.rate or cfg.ramp set, requests are due on a fixed timeline
+// instead and each RTT is measured from when its request was due rather
+// than when it was sent, so a server or sender that falls behind shows up in
+// the latencies instead of being hidden by fewer requests (coordinated
+// omission).
+//
+// With cfg.maxInflight set, at most that many requests are outstanding at a
+// time: a request is sent only once an earlier one has been answered or has
+// timed out.
+func runAsyncRequests(cfg config, host string) ([]result, error) {
+	u, err := stun.ParseURI("stun:" + host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+
+	d, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := resolveFamily(net.JoinHostPort(u.Host, strconv.Itoa(u.Port)), cfg.ipVersion)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial STUN server: %w", err)
+	}
+	defer conn.Close()
+
+	results := make([]result, cfg.runCount)
+	for i := range results {
+		results[i].index = i
+		results[i].arrival = -1
+		results[i].err = stun.ErrTransactionTimeOut
+	}
+
+	var mu sync.Mutex
+	pending := make(map[[stun.TransactionIDSize]byte]int)
+	// slots holds a token for every outstanding request when the number in
+	// flight is bounded.
+	var slots chan struct{}
+	if cfg.maxInflight > 0 {
+		slots = make(chan struct{}, cfg.maxInflight)
+	}
+	release := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+	answered := 0
+	allAnswered := make(chan struct{})
+
+	out := cfg.logOutput()
+	fmt.Fprintln(out, "Starting STUN requests...")
+	bar := cfg.progressBar(cfg.runCount)
+	hooks := cfg.responseHooks(addr)
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		buf := make([]byte, 1500)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			now := time.Now()
+
+			m := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if err := m.Decode(); err != nil {
+				if cfg.checkTruncation && n >= stunHeaderSize {
+					var txid [stun.TransactionIDSize]byte
+					copy(txid[:], buf[8:stunHeaderSize])
+					mu.Lock()
+					if i, ok := pending[txid]; ok {
+						results[i].err = classifyRaw(buf[:n])
+					}
+					mu.Unlock()
+				}
+				continue
+			}
+
+			mu.Lock()
+			i, ok := pending[m.TransactionID]
+			if ok && now.Sub(results[i].start) <= cfg.timeout {
+				delete(pending, m.TransactionID)
+				release()
+				r := &results[i]
+				r.time = now.Sub(r.start).Microseconds()
+				r.arrival = answered
+				r.err = nil
+
+				if cfg.strict {
+					r.err = checkFingerprint(m)
+				}
+				if r.err == nil && m.Type.Class == stun.ClassErrorResponse {
+					r.err = errorResponse(m)
+				}
+				if r.err == nil {
+					var xorAddr stun.XORMappedAddress
+					if err := xorAddr.GetFrom(m); err != nil {
+						r.err = err
+					} else {
+						r.mapped = &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}
+						r.err = checkRequiredAttrs(m, cfg.required)
+					}
+				}
+
+				runHooks(hooks, *r, m)
+
+				answered++
+				bar.Add(1)
+				if answered == cfg.runCount {
+					close(allAnswered)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	// offset, for an open-loop run, is when request i is due relative to
+	// schedule.
+	var schedule time.Time
+	var offset func(i int) time.Duration
+	var maxLag time.Duration
+	switch {
+	case cfg.ramp != nil:
+		offset = cfg.ramp.offset
+	case cfg.rate > 0:
+		period := time.Duration(float64(time.Second) / cfg.rate)
+		offset = func(i int) time.Duration { return time.Duration(i) * period }
+	}
+	if offset != nil {
+		schedule = time.Now()
+	}
+
+	for i := 0; i < cfg.runCount; i++ {
+		setters := append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, requestAttrs(cfg, i)...)
+		if cfg.strict {
+			setters = append(setters, stun.Fingerprint)
+		}
+		message := stun.MustBuild(setters...)
+
+		if slots != nil {
+			slots <- struct{}{}
+		}
+
+		due := time.Now()
+		if !schedule.IsZero() {
+			due = schedule.Add(offset(i))
+			time.Sleep(time.Until(due))
+			maxLag = max(maxLag, time.Since(due))
+		}
+
+		mu.Lock()
+		pending[message.TransactionID] = i
+		results[i].txid = message.TransactionID
+		results[i].size = len(message.Raw)
+		results[i].start = due
+		mu.Unlock()
+
+		if slots != nil {
+			// Free the slot of a request that is never answered.
+			time.AfterFunc(cfg.timeout, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if _, ok := pending[message.TransactionID]; ok {
+					delete(pending, message.TransactionID)
+					release()
+				}
+			})
+		}
+
+		sendStart := time.Now()
+		_, err := conn.Write(message.Raw)
+		sendBlock := time.Since(sendStart)
+
+		mu.Lock()
+		results[i].sendBlock = sendBlock
+		results[i].sendLag = sendStart.Sub(due)
+		if err != nil {
+			results[i].err = err
+			if _, ok := pending[message.TransactionID]; ok {
+				delete(pending, message.TransactionID)
+				release()
+			}
+		}
+		mu.Unlock()
+
+		if schedule.IsZero() && cfg.sendInterval > 0 {
+			time.Sleep(cfg.sendInterval)
+		}
+	}
+
+	select {
+	case <-allAnswered:
+	case <-time.After(cfg.timeout):
+	}
+	conn.Close()
+	<-readerDone
+
+	for _, r := range results {
+		if r.arrival < 0 {
+			runHooks(hooks, r, &stun.Message{TransactionID: r.txid})
+		}
+	}
+
+	fmt.Fprintln(out) // New line after progress bar
+	if cfg.maxInflight > 0 {
+		fmt.Fprintf(out, "Pipelined: at most %d requests in flight on one socket\n", cfg.maxInflight)
+	}
+	switch {
+	case cfg.ramp != nil:
+		fmt.Fprintf(out, "Open-loop ramp: %s, sends fell behind schedule by up to %d μs\n", cfg.ramp, maxLag.Microseconds())
+	case !schedule.IsZero():
+		fmt.Fprintf(out, "Open-loop rate: %g requests/s, sends fell behind schedule by up to %d μs\n", cfg.rate, maxLag.Microseconds())
+	}
+	return results, nil
+}
+
+// printReordering reports how many responses arrived after a response to a
+// later request, and the largest such displacement.
+func printReordering(results []result) {
+	bySequence := make([]int, 0, len(results))
+	for _, r := range results {
+		if r.arrival >= 0 {
+			bySequence = append(bySequence, r.arrival)
+		}
+	}
+
+	// results are in send order, so a response is out of order when a later
+	// request's response was received before it.
+	outOfOrder, maxDistance := 0, 0
+	highest := -1
+	for _, arrival := range bySequence {
+		if arrival < highest {
+			outOfOrder++
+			if d := highest - arrival; d > maxDistance {
+				maxDistance = d
+			}
+			continue
+		}
+		highest = arrival
+	}
+
+	fmt.Printf("\nOut-of-order responses: %d of %d", outOfOrder, len(bySequence))
+	if len(bySequence) > 0 {
+		fmt.Printf(" (%.2f%%)", float64(outOfOrder)/float64(len(bySequence))*100)
+	}
+	fmt.Println()
+	if outOfOrder > 0 {
+		fmt.Printf("Maximum reorder distance: %d\n", maxDistance)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/stun"
+)
+
+var attrsByName = map[string]stun.AttrType{
+	"MAPPED-ADDRESS":     stun.AttrMappedAddress,
+	"XOR-MAPPED-ADDRESS": stun.AttrXORMappedAddress,
+	"OTHER-ADDRESS":      stun.AttrOtherAddress,
+	"RESPONSE-ORIGIN":    stun.AttrResponseOrigin,
+	"CHANGED-ADDRESS":    stun.AttrChangedAddress,
+	"SOURCE-ADDRESS":     stun.AttrSourceAddress,
+	"SOFTWARE":           stun.AttrSoftware,
+	"FINGERPRINT":        stun.AttrFingerprint,
+	"MESSAGE-INTEGRITY":  stun.AttrMessageIntegrity,
+	"ALTERNATE-SERVER":   stun.AttrAlternateServer,
+}
+
+// attrName returns the RFC name of t, falling back to pion's formatting for
+// attributes it does not know by name (e.g. the RFC 5780 ones).
+func attrName(t stun.AttrType) string {
+	for name, known := range attrsByName {
+		if known == t {
+			return name
+		}
+	}
+	return t.String()
+}
+
+// attrList is a repeatable flag of STUN attribute types, given either by
+// name (OTHER-ADDRESS) or as a hex code (0x802c).
+type attrList []stun.AttrType
+
+func (l *attrList) String() string {
+	names := make([]string, len(*l))
+	for i, t := range *l {
+		names[i] = attrName(t)
+	}
+	return strings.Join(names, ",")
+}
+
+func (l *attrList) Set(value string) error {
+	if t, ok := attrsByName[strings.ToUpper(value)]; ok {
+		*l = append(*l, t)
+		return nil
+	}
+
+	code, err := strconv.ParseUint(value, 0, 16)
+	if err != nil {
+		return fmt.Errorf("unknown STUN attribute %q", value)
+	}
+	*l = append(*l, stun.AttrType(code))
+	return nil
+}
+
+// incompleteError marks a response that parsed correctly but lacked one or
+// more attributes required with -require-attr.
+type incompleteError struct {
+	missing []stun.AttrType
+}
+
+func (e *incompleteError) Error() string {
+	names := make([]string, len(e.missing))
+	for i, t := range e.missing {
+		names[i] = attrName(t)
+	}
+	return "response missing " + strings.Join(names, ", ")
+}
+
+func checkRequiredAttrs(m *stun.Message, required attrList) error {
+	var missing []stun.AttrType
+	for _, t := range required {
+		if !m.Contains(t) {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		return &incompleteError{missing: missing}
+	}
+	return nil
+}
+
+func printIncomplete(incomplete []*incompleteError) {
+	var order []stun.AttrType
+	counts := make(map[stun.AttrType]int)
+	for _, ie := range incomplete {
+		for _, t := range ie.missing {
+			if counts[t] == 0 {
+				order = append(order, t)
+			}
+			counts[t]++
+		}
+	}
+
+	fmt.Printf("Incomplete responses: %d\n", len(incomplete))
+	for _, t := range order {
+		fmt.Printf("  missing %s: %d\n", attrName(t), counts[t])
+	}
+}
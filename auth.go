@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// longTermCredentials are the long-term credentials for a STUN or TURN
+// server, along with the realm and nonce it last handed out.
+type longTermCredentials struct {
+	username, password string
+	realm              stun.Realm
+	nonce              stun.Nonce
+
+	// expectedRealm, if set, is the realm the server has to announce.
+	expectedRealm string
+}
+
+// challenge updates the realm and nonce from a 401 or 438 response and
+// reports whether the request should be retried with them.
+func (t *longTermCredentials) challenge(res *stun.Message) bool {
+	var code stun.ErrorCodeAttribute
+	if code.GetFrom(res) != nil || (code.Code != stun.CodeUnauthorized && code.Code != stun.CodeStaleNonce) {
+		return false
+	}
+	if t.nonce.GetFrom(res) != nil {
+		return false
+	}
+	if code.Code == stun.CodeUnauthorized && t.realm.GetFrom(res) != nil {
+		return false
+	}
+	// The attributes point into the client's read buffer, which the next
+	// response overwrites.
+	t.nonce = append(stun.Nonce(nil), t.nonce...)
+	t.realm = append(stun.Realm(nil), t.realm...)
+	return true
+}
+
+func (t *longTermCredentials) setters() []stun.Setter {
+	return []stun.Setter{
+		stun.NewUsername(t.username), t.realm, t.nonce,
+		stun.NewLongTermIntegrity(t.username, t.realm.String(), t.password),
+	}
+}
+
+// errorResponse describes the ERROR-CODE of a STUN error response.
+func errorResponse(res *stun.Message) error {
+	var code stun.ErrorCodeAttribute
+	if code.GetFrom(res) != nil {
+		return fmt.Errorf("%s failed without an error code", res.Type.Method)
+	}
+	return fmt.Errorf("%s failed: %d %s", res.Type.Method, code.Code, code.Reason)
+}
+
+// fetchNonce sends an unauthenticated request of type t to learn the realm
+// and nonce from the server's 401, and keeps its round-trip time in
+// p.challenge until it is attributed to the authenticated request that
+// follows.
+func (p *prober) fetchNonce(creds *longTermCredentials, t stun.MessageType, attrs ...stun.Setter) error {
+	m := stun.MustBuild(append(append([]stun.Setter{stun.TransactionID, t}, attrs...), stun.Fingerprint)...)
+	start := time.Now()
+	res, err := p.transact(m)
+	p.challenge += time.Since(start)
+	if err != nil {
+		return err
+	}
+	if res.Type.Class == stun.ClassSuccessResponse {
+		return fmt.Errorf("%s succeeded without credentials", t.Method)
+	}
+	if !creds.challenge(res) {
+		return errorResponse(res)
+	}
+	if creds.expectedRealm != "" && creds.realm.String() != creds.expectedRealm {
+		return fmt.Errorf("server realm %q does not match -realm %q", creds.realm, creds.expectedRealm)
+	}
+	return nil
+}
+
+// authenticated sends a request of type t with creds, fetching a realm and
+// nonce first if there is none yet or the server reports it as stale, and
+// returns the success response. The returned time is that of the
+// authenticated request alone; unauthenticated round trips are added to
+// p.challenge.
+func (p *prober) authenticated(creds *longTermCredentials, t stun.MessageType, attrs ...stun.Setter) (*stun.Message, time.Duration, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		if creds.nonce == nil {
+			if err := p.fetchNonce(creds, t, attrs...); err != nil {
+				return nil, 0, err
+			}
+		}
+		setters := append([]stun.Setter{stun.TransactionID, t}, attrs...)
+		setters = append(setters, creds.setters()...)
+		m := stun.MustBuild(append(setters, stun.Fingerprint)...)
+
+		start := time.Now()
+		res, err := p.transact(m)
+		rtt := time.Since(start)
+		if err != nil {
+			return nil, rtt, err
+		}
+		if res.Type.Class == stun.ClassSuccessResponse {
+			return res, rtt, nil
+		}
+
+		// A 401 to a request that already carried credentials means they
+		// are wrong; only a stale nonce is worth another attempt.
+		var code stun.ErrorCodeAttribute
+		if code.GetFrom(res) != nil || code.Code != stun.CodeStaleNonce || !creds.challenge(res) {
+			return nil, rtt, errorResponse(res)
+		}
+		p.challenge += rtt
+	}
+	return nil, 0, fmt.Errorf("%s failed: server keeps sending new nonces", t.Method)
+}
+
+// bindingCredentials returns the credentials Binding requests are
+// authenticated with, or nil without -user.
+func bindingCredentials(cfg config) (*longTermCredentials, error) {
+	if cfg.user == "" {
+		return nil, nil
+	}
+	if cfg.password == "" {
+		return nil, errors.New("-user needs -password")
+	}
+	return &longTermCredentials{username: cfg.user, password: cfg.password, expectedRealm: cfg.realm}, nil
+}
+
+// printChallenges reports the unauthenticated round trips that fetched a
+// nonce before an authenticated request, next to the authenticated ones.
+func printChallenges(results []result) {
+	var times []int64
+	for _, r := range results {
+		if r.challenge > 0 {
+			times = append(times, r.challenge.Microseconds())
+		}
+	}
+	switch len(times) {
+	case 0:
+	case 1:
+		fmt.Printf("\nUnauthenticated round trip (401): %d μs\n", times[0])
+	default:
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		fmt.Printf("\nUnauthenticated round trips (401/438): %d, p50 %d μs, p100 %d μs\n",
+			len(times), percentile(times, 50), times[len(times)-1])
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// runBaseline measures the same host with ICMP echo, or with TCP connect
+// timing when raw ICMP sockets are not permitted, and prints it next to the
+// STUN results to show how much of the RTT is STUN-specific.
+func runBaseline(cfg config, stunResults []result) error {
+	u, err := stun.ParseURI("stun:" + cfg.stunHost)
+	if err != nil {
+		return fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	// The baseline has to take the same path as STUN, so -4 and -6 apply.
+	ips, err := lookupFamily(context.Background(), u.Host, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+	ip := ips[0]
+
+	label := "ICMP echo"
+	results, err := pingICMP(ip, cfg.runCount, cfg.timeout)
+	if err != nil {
+		fmt.Printf("\nICMP unavailable (%v), falling back to TCP connect timing\n", err)
+		label = "TCP connect"
+		results = timeTCPConnect(net.JoinHostPort(ip.String(), strconv.Itoa(u.Port)), cfg.runCount, cfg.timeout)
+	}
+
+	fmt.Println("\nSTUN vs baseline:")
+	printComparison([]comparisonRow{
+		{label: "STUN binding", results: stunResults},
+		{label: label, results: results},
+	})
+
+	stunTimes, baseTimes := sortedSuccessfulTimes(stunResults), sortedSuccessfulTimes(results)
+	if len(stunTimes) > 0 && len(baseTimes) > 0 {
+		fmt.Printf("STUN overhead at p50: %+d μs\n", percentile(stunTimes, 50)-percentile(baseTimes, 50))
+	}
+	return nil
+}
+
+func pingICMP(dst net.IP, count int, timeout time.Duration) ([]result, error) {
+	network, echoType, replyType := "ip4:icmp", byte(8), byte(0)
+	if dst.To4() == nil {
+		network, echoType, replyType = "ip6:ipv6-icmp", 128, 129
+	}
+
+	conn, err := net.ListenPacket(network, "")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid())
+	results := make([]result, count)
+	buf := make([]byte, 1500)
+
+	for i := 0; i < count; i++ {
+		seq := uint16(i)
+		msg := make([]byte, 8+32)
+		msg[0] = echoType
+		binary.BigEndian.PutUint16(msg[4:6], id)
+		binary.BigEndian.PutUint16(msg[6:8], seq)
+		if echoType == 8 {
+			// The kernel fills in the ICMPv6 checksum, but not ICMPv4's.
+			binary.BigEndian.PutUint16(msg[2:4], icmpChecksum(msg))
+		}
+
+		start := time.Now()
+		results[i] = result{index: i, start: start, err: stun.ErrTransactionTimeOut}
+		if _, err := conn.WriteTo(msg, &net.IPAddr{IP: dst}); err != nil {
+			results[i].err = err
+			continue
+		}
+
+		deadline := start.Add(timeout)
+		conn.SetReadDeadline(deadline)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			if n >= 8 && buf[0] == replyType &&
+				binary.BigEndian.Uint16(buf[4:6]) == id && binary.BigEndian.Uint16(buf[6:8]) == seq {
+				results[i].time = time.Since(start).Microseconds()
+				results[i].err = nil
+				break
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// timeTCPConnect times TCP handshakes to addr. A refused connection still
+// costs exactly one round trip, so it counts as a successful sample.
+func timeTCPConnect(addr string, count int, timeout time.Duration) []result {
+	results := make([]result, count)
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		elapsed := time.Since(start).Microseconds()
+		if err == nil {
+			conn.Close()
+		} else if isConnRefused(err) {
+			err = nil
+		}
+		results[i] = result{index: i, start: start, time: elapsed, err: err}
+	}
+	return results
+}
+
+func isConnRefused(err error) bool {
+	var se *os.SyscallError
+	return errors.As(err, &se) && se.Syscall == "connect" && errors.Is(se.Err, errConnRefused)
+}
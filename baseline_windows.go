@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// WSAECONNREFUSED
+var errConnRefused error = syscall.Errno(10061)
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// Binary records are fixed-size and little-endian:
+//
+//	offset 0  int64  request start, Unix nanoseconds
+//	offset 8  int32  round-trip time, microseconds
+//	offset 12 uint8  error code (see errCode*)
+const binaryRecordSize = 13
+
+const (
+	errCodeNone    = 0
+	errCodeTimeout = 1
+	errCodeOther   = 2
+)
+
+var (
+	errDecodedTimeout = errors.New("timeout")
+	errDecodedOther   = errors.New("error")
+)
+
+func errorCode(err error) byte {
+	switch {
+	case err == nil:
+		return errCodeNone
+	case errors.Is(err, stun.ErrTransactionTimeOut):
+		return errCodeTimeout
+	default:
+		return errCodeOther
+	}
+}
+
+func writeBinaryResults(path string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, r := range results {
+		if err := writeBinaryRecord(w, r); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+func writeBinaryRecord(w io.Writer, r result) error {
+	var rec [binaryRecordSize]byte
+	binary.LittleEndian.PutUint64(rec[0:8], uint64(r.start.UnixNano()))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(int32(r.time)))
+	rec[12] = errorCode(r.err)
+	_, err := w.Write(rec[:])
+	return err
+}
+
+func readBinaryResults(path string) ([]result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer f.Close()
+
+	return readBinaryRecords(bufio.NewReader(f))
+}
+
+// readBinaryRecords reads records until EOF. A trailing partial record is
+// reported as io.ErrUnexpectedEOF along with the complete ones before it.
+func readBinaryRecords(r io.Reader) ([]result, error) {
+	var results []result
+	var rec [binaryRecordSize]byte
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, rec[:]); err != nil {
+			if err == io.EOF {
+				return results, nil
+			}
+			return results, fmt.Errorf("failed to read record %d: %w", i, err)
+		}
+
+		res := result{
+			index: i,
+			start: time.Unix(0, int64(binary.LittleEndian.Uint64(rec[0:8]))),
+			time:  int64(int32(binary.LittleEndian.Uint32(rec[8:12]))),
+		}
+		switch rec[12] {
+		case errCodeNone:
+		case errCodeTimeout:
+			res.err = errDecodedTimeout
+		default:
+			res.err = errDecodedOther
+		}
+		results = append(results, res)
+	}
+}
+
+func printDecodedResults(results []result) {
+	for _, r := range results {
+		status := "ok"
+		if r.err != nil {
+			status = r.err.Error()
+		}
+		fmt.Printf("%d %s rtt=%dμs %s\n", r.index, r.start.Format(time.RFC3339Nano), r.time, status)
+	}
+}
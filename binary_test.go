@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	start := time.Unix(1700000000, 123456789)
+	in := []result{
+		{start: start, time: 1234},
+		{start: start.Add(time.Second), time: 0, err: stun.ErrTransactionTimeOut},
+		{start: start.Add(2 * time.Second), time: 99, err: fmt.Errorf("wrapped: %w", stun.ErrTransactionTimeOut)},
+		{start: start.Add(3 * time.Second), time: 5000, err: errors.New("Binding failed: 401 Unauthorized")},
+		{start: start.Add(4 * time.Second), time: 1<<31 - 1},
+	}
+	wantErrs := []error{nil, errDecodedTimeout, errDecodedTimeout, errDecodedOther, nil}
+
+	var buf bytes.Buffer
+	for _, r := range in {
+		if err := writeBinaryRecord(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != len(in)*binaryRecordSize {
+		t.Fatalf("wrote %d bytes, want %d", buf.Len(), len(in)*binaryRecordSize)
+	}
+
+	out, err := readBinaryRecords(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("read %d records, want %d", len(out), len(in))
+	}
+	for i, r := range out {
+		if r.index != i || !r.start.Equal(in[i].start) || r.time != in[i].time || r.err != wantErrs[i] {
+			t.Errorf("record %d = {%d %s %d %v}, want {%d %s %d %v}", i, r.index, r.start, r.time, r.err, i, in[i].start, in[i].time, wantErrs[i])
+		}
+	}
+}
+
+func TestReadBinaryRecordsPartial(t *testing.T) {
+	var buf bytes.Buffer
+	writeBinaryRecord(&buf, result{start: time.Unix(0, 1), time: 10})
+	buf.Write(make([]byte, binaryRecordSize-1))
+
+	out, err := readBinaryRecords(&buf)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if len(out) != 1 || out[0].time != 10 {
+		t.Errorf("got %v, want the one complete record", out)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+)
+
+// bindToDevice returns a dialer Control function that pins the socket to the
+// named network interface with SO_BINDTODEVICE.
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+func bindToDevice(iface string) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, errors.New("-interface is only supported on Linux")
+}
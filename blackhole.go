@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+)
+
+// blackholeSizes are the total request sizes tried, in bytes. 1472 fills a
+// 1500-byte IPv4 MTU exactly and 1452 does the same for IPv6.
+var blackholeSizes = []int{128, 256, 512, 1024, 1200, 1280, 1350, 1400, 1452, 1472}
+
+// blackholeMinProbes is the fewest requests sent per size, so that one
+// random loss is not mistaken for black-holing.
+const blackholeMinProbes = 5
+
+// runBlackholeTest sends requests of increasing size on one socket and looks
+// for the size at which they stop getting answered while smaller ones still
+// are, the signature of path MTU black-holing.
+func runBlackholeTest(cfg config) error {
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	probes := max(cfg.runCount, blackholeMinProbes)
+
+	var rows []comparisonRow
+	rates := make([]float64, len(blackholeSizes))
+	for i, size := range blackholeSizes {
+		sizeCfg := cfg
+		sizeCfg.runCount = probes
+		sizeCfg.duration = 0
+		sizeCfg.quiet = true
+		// The attribute header takes 4 bytes on top of the 20-byte message
+		// header.
+		sizeCfg.padding = size - stunHeaderSize - 4
+
+		fmt.Printf("Probing %d-byte requests...\n", size)
+		results, err := p.run(sizeCfg)
+		if err != nil {
+			return fmt.Errorf("%d-byte requests: %w", size, err)
+		}
+
+		rows = append(rows, comparisonRow{label: fmt.Sprintf("%d bytes", size), results: results})
+		rates[i] = float64(len(sortedSuccessfulTimes(results))) / float64(len(results))
+	}
+
+	fmt.Println()
+	printComparison(rows)
+	fmt.Println()
+
+	// A size is considered working when at least half its probes succeed.
+	const working = 0.5
+	if rates[0] < working {
+		fmt.Println("Verdict: even small requests fail; the path is lossy rather than size-dependent")
+		return nil
+	}
+	for i := 1; i < len(blackholeSizes); i++ {
+		if rates[i] >= working {
+			continue
+		}
+		larger := true
+		for _, r := range rates[i:] {
+			if r >= working {
+				larger = false
+			}
+		}
+		if larger {
+			fmt.Printf("Verdict: black hole detected; requests of %d bytes or more fail (largest working size %d bytes)\n",
+				blackholeSizes[i], blackholeSizes[i-1])
+		} else {
+			fmt.Printf("Verdict: inconclusive; %d-byte requests fail but some larger sizes succeed\n", blackholeSizes[i])
+		}
+		return nil
+	}
+
+	fmt.Printf("Verdict: no black-holing up to %d bytes\n", blackholeSizes[len(blackholeSizes)-1])
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// bootstrapResamples is how many resamples bootstrapCIs draws.
+const bootstrapResamples = 1000
+
+// bootstrapCIs returns 95% confidence intervals for the given percentiles of
+// sorted, by the percentile bootstrap: the percentiles are recomputed on
+// bootstrapResamples resamples drawn with replacement, and the interval runs
+// from the 2.5th to the 97.5th percentile of those estimates.
+//
+// Since sorted is already in order, a resample is kept as a count of how
+// often each sample was drawn, which avoids sorting every resample.
+func bootstrapCIs(sorted []int64, percentiles []float64) (lo, hi []int64) {
+	n := len(sorted)
+	estimates := make([][]int64, len(percentiles))
+	counts := make([]int, n)
+	for range bootstrapResamples {
+		clear(counts)
+		for range n {
+			counts[rand.Intn(n)]++
+		}
+		for i, p := range percentiles {
+			estimates[i] = append(estimates[i], resampledPercentile(sorted, counts, p))
+		}
+	}
+
+	lo, hi = make([]int64, len(percentiles)), make([]int64, len(percentiles))
+	for i, e := range estimates {
+		sort.Slice(e, func(a, b int) bool { return e[a] < e[b] })
+		lo[i], hi[i] = percentile(e, 2.5), percentile(e, 97.5)
+	}
+	return lo, hi
+}
+
+// resampledPercentile is percentile for the resample in which sorted[i] was
+// drawn counts[i] times.
+func resampledPercentile(sorted []int64, counts []int, p float64) int64 {
+	pos := float64(len(sorted)-1) * p / 100
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	loValue := int64(-1)
+	seen := 0
+	for i, c := range counts {
+		seen += c
+		if seen > lo && loValue < 0 {
+			loValue = sorted[i]
+		}
+		if seen > hi {
+			return loValue + int64(math.Round(float64(sorted[i]-loValue)*(pos-float64(lo))))
+		}
+	}
+	return sorted[len(sorted)-1]
+}
+
+// printPercentileCIs prints the percentile table with a confidence interval
+// for every row.
+func printPercentileCIs(percentiles []float64, sorted []int64) {
+	lo, hi := bootstrapCIs(sorted, percentiles)
+	fmt.Println("┌───────┬───────────┬─────────────────────┐")
+	fmt.Printf("│ %%tile │ Time (μs) │   95%% CI (μs)       │\n")
+	fmt.Println("├───────┼───────────┼─────────────────────┤")
+	for i, p := range percentiles {
+		fmt.Printf("│ %-5s │ %9d │ %19s │\n", percentileCell(p), percentile(sorted, p), fmt.Sprintf("%d - %d", lo[i], hi[i]))
+	}
+	fmt.Println("└───────┴───────────┴─────────────────────┘")
+}
+
+// addBootstrapCIs fills in the confidence intervals of a JSON report's
+// percentiles, which like the percentiles cover warm requests only.
+func addBootstrapCIs(percentiles []jsonPercentile, results []result, warmedUp bool) {
+	var times []int64
+	cold := coldStartIndex(results, warmedUp)
+	for i, r := range results {
+		if r.err == nil && i != cold {
+			times = append(times, r.time)
+		}
+	}
+	if len(times) == 0 || len(percentiles) == 0 {
+		return
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	ps := make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		ps[i] = p.Percentile
+	}
+	lo, hi := bootstrapCIs(times, ps)
+	for i := range percentiles {
+		percentiles[i].CILow, percentiles[i].CIHigh = lo[i], hi[i]
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The bufferbloat test probes for bufferbloatPhase while the link is idle
+// and again for as long while background traffic loads it, a probe every
+// bufferbloatInterval unless -interval is set.
+const (
+	bufferbloatPhase    = 10 * time.Second
+	bufferbloatInterval = 100 * time.Millisecond
+	loadPacketSize      = 1200
+)
+
+// bufferbloatGrades maps the added p50 latency under load to a grade, on
+// the scale the common web bufferbloat tests use.
+var bufferbloatGrades = []struct {
+	max   time.Duration
+	grade string
+}{
+	{5 * time.Millisecond, "A+"},
+	{30 * time.Millisecond, "A"},
+	{60 * time.Millisecond, "B"},
+	{200 * time.Millisecond, "C"},
+	{400 * time.Millisecond, "D"},
+}
+
+func bufferbloatGrade(added time.Duration) string {
+	for _, g := range bufferbloatGrades {
+		if added < g.max {
+			return g.grade
+		}
+	}
+	return "F"
+}
+
+// parseBitrate parses a rate in bits per second like "20M", "500k" or
+// "20Mbps".
+func parseBitrate(s string) (float64, error) {
+	v := strings.TrimSuffix(strings.TrimSuffix(s, "bps"), "bit/s")
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(v, "k"), strings.HasSuffix(v, "K"):
+		scale = 1e3
+	case strings.HasSuffix(v, "M"):
+		scale = 1e6
+	case strings.HasSuffix(v, "G"):
+		scale = 1e9
+	}
+	if scale != 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid bit rate %q (want e.g. 20M)", s)
+	}
+	return n * scale, nil
+}
+
+// udpLoad sends UDP traffic to a target at a fixed bit rate and counts what
+// comes back, so that an echo service loads both directions of the link.
+type udpLoad struct {
+	conn     net.Conn
+	sent     atomic.Int64
+	received atomic.Int64
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func startUDPLoad(cfg config) (*udpLoad, error) {
+	d, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.Dial("udp", cfg.loadTarget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial load target: %w", err)
+	}
+	l := &udpLoad{conn: conn, stop: make(chan struct{})}
+	l.wg.Add(2)
+	go l.send(cfg.loadRate)
+	go l.receive()
+	return l, nil
+}
+
+// send paces packets by checking every millisecond how many bytes are due.
+func (l *udpLoad) send(bitrate float64) {
+	defer l.wg.Done()
+	packet := make([]byte, loadPacketSize)
+	start := time.Now()
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		due := int64(time.Since(start).Seconds() * bitrate / 8)
+		for l.sent.Load()+loadPacketSize <= due {
+			if _, err := l.conn.Write(packet); err != nil {
+				// Buffers overflowing under load is expected; count the
+				// packet as sent so pacing does not try to catch up.
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+			}
+			l.sent.Add(loadPacketSize)
+		}
+	}
+}
+
+func (l *udpLoad) receive() {
+	defer l.wg.Done()
+	buf := make([]byte, 65535)
+	for {
+		n, err := l.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		l.received.Add(int64(n))
+	}
+}
+
+func (l *udpLoad) Close() {
+	close(l.stop)
+	l.conn.Close()
+	l.wg.Wait()
+}
+
+// runBufferbloat measures the STUN RTT on an idle link and again while
+// background UDP traffic loads it, and grades the latency added under load.
+func runBufferbloat(cfg config) error {
+	if cfg.loadTarget == "" {
+		return errors.New("-bufferbloat needs -load-target, a UDP sink or echo service to send background traffic to")
+	}
+	probeCfg := cfg
+	probeCfg.duration = bufferbloatPhase
+	probeCfg.quiet = true
+	if probeCfg.interval <= 0 {
+		probeCfg.interval = bufferbloatInterval
+	}
+
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	fmt.Printf("Idle: probing %s for %s...\n", cfg.stunHost, bufferbloatPhase)
+	idle, err := p.run(probeCfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Loaded: sending %s bit/s to %s while probing for %s...\n", formatBitrate(cfg.loadRate), cfg.loadTarget, bufferbloatPhase)
+	load, err := startUDPLoad(cfg)
+	if err != nil {
+		return err
+	}
+	loadStart := time.Now()
+	loaded, err := p.run(probeCfg)
+	elapsed := time.Since(loadStart)
+	load.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printComparison([]comparisonRow{
+		{label: "Idle", results: idle},
+		{label: "Loaded", results: loaded},
+	})
+	fmt.Printf("\nBackground traffic: %s bit/s up, %s bit/s down\n",
+		formatBitrate(float64(load.sent.Load())*8/elapsed.Seconds()),
+		formatBitrate(float64(load.received.Load())*8/elapsed.Seconds()))
+
+	idleTimes, loadedTimes := sortedSuccessfulTimes(idle), sortedSuccessfulTimes(loaded)
+	if len(idleTimes) == 0 || len(loadedTimes) == 0 {
+		fmt.Println("Not enough successful requests to grade bufferbloat")
+		return nil
+	}
+	added := time.Duration(percentile(loadedTimes, 50)-percentile(idleTimes, 50)) * time.Microsecond
+	fmt.Printf("Latency added under load: %+d μs at p50, %+d μs at p95\n",
+		added.Microseconds(), percentile(loadedTimes, 95)-percentile(idleTimes, 95))
+	fmt.Printf("Bufferbloat grade: %s\n", bufferbloatGrade(added))
+	return nil
+}
+
+// formatBitrate formats bits per second with a k, M or G prefix.
+func formatBitrate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.1fG", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.1fM", bps/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.1fk", bps/1e3)
+	default:
+		return fmt.Sprintf("%.0f", bps)
+	}
+}
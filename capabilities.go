@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// support is whether a server supports an RFC 5780 feature. known is false
+// when the probe could not tell, e.g. because the answer may have been
+// filtered by the NAT rather than never sent.
+type support struct {
+	known, ok bool
+	note      string
+}
+
+func (s support) String() string {
+	v := "no"
+	switch {
+	case !s.known:
+		v = "unknown"
+	case s.ok:
+		v = "yes"
+	}
+	if s.note != "" {
+		v += " (" + s.note + ")"
+	}
+	return v
+}
+
+// serverCapabilities records which of the RFC 5780 NAT behavior discovery
+// features a STUN server supports.
+type serverCapabilities struct {
+	tests []*natTest
+	// other is the server's alternate address, from OTHER-ADDRESS.
+	other *net.UDPAddr
+
+	otherAddress   support
+	responseOrigin support
+	changePort     support
+	changeIP       support
+}
+
+// changeSupport tells from t, a request with CHANGE-REQUEST sent to server,
+// whether the server honors the flag. Without a NAT in the way, a missing
+// answer means the server dropped the request.
+func changeSupport(t *natTest, server *net.UDPAddr, natted bool) support {
+	switch {
+	case errors.Is(t.err, errNoResponse) && natted:
+		return support{note: "no response; the server may ignore it or the NAT filtered the answer"}
+	case errors.Is(t.err, errNoResponse):
+		return support{known: true, note: "no response"}
+	case t.err != nil:
+		return support{known: true, note: t.err.Error()}
+	}
+	changed := t.from.Port != server.Port
+	if t.change&changeIP != 0 {
+		changed = !t.from.IP.Equal(server.IP)
+	}
+	if !changed {
+		return support{known: true, note: fmt.Sprintf("answered from %s", t.from)}
+	}
+	return support{known: true, ok: true, note: fmt.Sprintf("answered from %s", t.from)}
+}
+
+// probeCapabilities finds out whether the server at server reports
+// OTHER-ADDRESS and RESPONSE-ORIGIN, and whether it answers CHANGE-REQUEST
+// from its alternate port and from its alternate IP. The port is probed
+// first because a NAT with address-dependent filtering still lets that
+// answer through.
+func probeCapabilities(cfg config, server *net.UDPAddr) (*serverCapabilities, error) {
+	c := &serverCapabilities{}
+	s, err := listenNAT(cfg)
+	if err != nil {
+		return c, err
+	}
+	defer s.Close()
+
+	base := &natTest{name: "Probe I", to: server}
+	s.run(base)
+	c.tests = append(c.tests, base)
+	if base.err != nil {
+		return c, fmt.Errorf("%s: %w", base.name, base.err)
+	}
+
+	c.other = base.other
+	c.otherAddress = support{known: true, ok: c.other != nil}
+	if c.other != nil {
+		c.otherAddress.note = c.other.String()
+	}
+	c.responseOrigin = support{known: true, ok: base.origin != nil}
+
+	_, port := addrIPPort(s.conn.LocalAddr())
+	natted := !sameAddr(base.mapped, &net.UDPAddr{IP: currentLocalIP(s.d, server), Port: port})
+
+	portOnly := &natTest{name: "Probe II", to: server, change: changePort}
+	s.run(portOnly)
+	c.tests = append(c.tests, portOnly)
+	c.changePort = changeSupport(portOnly, server, natted)
+
+	ipOnly := &natTest{name: "Probe III", to: server, change: changeIP}
+	s.run(ipOnly)
+	c.tests = append(c.tests, ipOnly)
+	c.changeIP = changeSupport(ipOnly, server, natted)
+	return c, nil
+}
+
+func printCapabilities(c *serverCapabilities) {
+	fmt.Println("Server capabilities:")
+	fmt.Printf("  %-24s %s\n", "OTHER-ADDRESS", c.otherAddress)
+	fmt.Printf("  %-24s %s\n", "RESPONSE-ORIGIN", c.responseOrigin)
+	fmt.Printf("  %-24s %s\n", "CHANGE-REQUEST (port)", c.changePort)
+	fmt.Printf("  %-24s %s\n", "CHANGE-REQUEST (IP)", c.changeIP)
+}
+
+// printDiagnostics lists which NAT diagnostics the server's capabilities
+// allow.
+func printDiagnostics(c *serverCapabilities) {
+	change := c.changePort.ok && c.changeIP.ok
+	diagnostic := func(flag string, possible bool, missing string) {
+		if possible {
+			fmt.Printf("  %-24s possible\n", flag)
+		} else {
+			fmt.Printf("  %-24s needs %s\n", flag, missing)
+		}
+	}
+	fmt.Println("Diagnostics:")
+	diagnostic("-nat-mapping", c.otherAddress.ok, "OTHER-ADDRESS, or several servers in -host")
+	diagnostic("-nat-filtering", change, "CHANGE-REQUEST")
+	switch {
+	case !c.otherAddress.ok && !change:
+		diagnostic("-nat-check", false, "OTHER-ADDRESS and CHANGE-REQUEST")
+	case !c.otherAddress.ok:
+		diagnostic("-nat-check", false, "OTHER-ADDRESS")
+	default:
+		diagnostic("-nat-check", change, "CHANGE-REQUEST")
+	}
+}
+
+// runCapabilities probes the server for the RFC 5780 features the NAT
+// diagnostics rely on and reports which of them can be run against it.
+func runCapabilities(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-server-capabilities needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("RFC 5780 capability probe of %s\n\n", server)
+	c, err := probeCapabilities(cfg, server)
+	printNATTests(c.tests)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	printCapabilities(c)
+	fmt.Println()
+	printDiagnostics(c)
+	return nil
+}
+
+// printServerCapabilities shows the capability matrix ahead of the NAT
+// behavior tests, so that a test failing for lack of server support is
+// recognizable as such. A server that does not answer at all is left to the
+// tests to report.
+func printServerCapabilities(cfg config, server *net.UDPAddr) {
+	c, err := probeCapabilities(cfg, server)
+	if err != nil {
+		return
+	}
+	printCapabilities(c)
+	fmt.Println()
+}
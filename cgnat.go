@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// sharedAddressSpace is the range reserved for carrier-grade NAT (RFC 6598).
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// natVerdict compares the local interface address with the mapped address
+// the server saw and says whether, and how, the path is NATed. CGNAT is
+// reported when either address is in the shared address space; a private
+// local address with a public mapped one cannot by itself rule out CGNAT
+// behind the home router.
+func natVerdict(local, mapped net.IP) string {
+	switch {
+	case local == nil || mapped == nil:
+		return "unknown"
+	case local.Equal(mapped):
+		return "no NAT (mapped address is the local address)"
+	case sharedAddressSpace.Contains(local):
+		return fmt.Sprintf("behind CGNAT (local address %s is in %s)", local, sharedAddressSpace)
+	case sharedAddressSpace.Contains(mapped):
+		return fmt.Sprintf("behind CGNAT (server sees %s, in %s)", mapped, sharedAddressSpace)
+	case local.To4() == nil:
+		return "IPv6 address translation (no CGNAT)"
+	case local.IsPrivate():
+		return "behind NAT, no sign of CGNAT"
+	default:
+		return fmt.Sprintf("behind NAT although the local address %s is public", local)
+	}
+}
+
+// firstNATVerdict returns the verdict for the first successful request that
+// recorded both addresses.
+func firstNATVerdict(results []result) string {
+	for _, r := range results {
+		if r.err == nil && r.local != nil && r.mapped != nil {
+			return natVerdict(r.local, r.mapped.IP)
+		}
+	}
+	return natVerdict(nil, nil)
+}
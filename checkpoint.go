@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// checkpointer appends results to a binary capture file as they come in,
+// flushing them to disk every interval so an interrupted run loses at most
+// that much data.
+type checkpointer struct {
+	f         *os.File
+	w         *bufio.Writer
+	interval  time.Duration
+	lastFlush time.Time
+}
+
+// openCheckpoint opens path for checkpointing. With resume, the records
+// already in the file are returned and new ones are appended after them;
+// otherwise the file is started afresh.
+func openCheckpoint(path string, interval time.Duration, resume bool) (*checkpointer, []result, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open checkpoint file: %w", err)
+	}
+
+	resumed, err := readBinaryRecords(bufio.NewReader(f))
+	// A crash mid-write leaves a partial record at the end; drop it.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		f.Close()
+		return nil, nil, err
+	}
+	end := int64(len(resumed) * binaryRecordSize)
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to truncate checkpoint file: %w", err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to seek checkpoint file: %w", err)
+	}
+
+	return &checkpointer{
+		f:         f,
+		w:         bufio.NewWriter(f),
+		interval:  interval,
+		lastFlush: time.Now(),
+	}, resumed, nil
+}
+
+func (c *checkpointer) record(r result) error {
+	if err := writeBinaryRecord(c.w, r); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if time.Since(c.lastFlush) < c.interval {
+		return nil
+	}
+	return c.flush()
+}
+
+func (c *checkpointer) flush() error {
+	c.lastFlush = time.Now()
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := c.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (c *checkpointer) Close() error {
+	err := c.flush()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
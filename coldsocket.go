@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// dialAddrs returns the addresses to dial, in the resolver's order of
+// preference and of the family selected with -4 or -6 if any. A host name
+// is looked up for every new socket, like the dialer itself would, and its
+// addresses are kept in p.resolved. With resolveEach the lookup time is kept
+// in p.lookup until it is attributed to the first request on that socket.
+// Go's resolver does not cache, though the system's may.
+func (p *prober) dialAddrs() ([]string, error) {
+	host, port, err := net.SplitHostPort(p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %q: %w", p.addr, err)
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		addr, err := resolveFamily(p.addr, p.ipVersion)
+		if err != nil {
+			return nil, err
+		}
+		return []string{addr}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	start := time.Now()
+	ips, err := lookupFamily(ctx, host, p.ipVersion)
+	if err != nil {
+		return nil, err
+	}
+	if p.resolveEach {
+		p.lookup = time.Since(start)
+	}
+	p.resolved = ips
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip.String(), port)
+	}
+	return addrs, nil
+}
+
+// runColdCompare measures the server twice, once reusing one socket and once
+// opening a fresh socket for every request, and shows the two side by side.
+// The first request of the warm run opened its socket, so it is left out of
+// the warm row.
+func runColdCompare(cfg config) error {
+	warmCfg := cfg
+	warmCfg.reconnect, warmCfg.resolveEach = false, false
+	warm, err := runSTUNRequests(warmCfg, cfg.stunHost)
+	if err != nil {
+		return fmt.Errorf("warm socket: %w", err)
+	}
+	if len(warm) > 0 {
+		warm = warm[1:]
+	}
+
+	coldCfg := cfg
+	coldCfg.reconnect = true
+	cold, err := runSTUNRequests(coldCfg, cfg.stunHost)
+	if err != nil {
+		return fmt.Errorf("fresh sockets: %w", err)
+	}
+
+	coldLabel := "Fresh socket per request"
+	if cfg.resolveEach {
+		coldLabel += " + DNS"
+	}
+	fmt.Println()
+	printComparison([]comparisonRow{
+		{label: "Warm socket", results: warm},
+		{label: coldLabel, results: cold},
+	})
+	printConnectSetup(cold, cfg.transport)
+
+	warmTimes, coldTimes := sortedSuccessfulTimes(warm), sortedSuccessfulTimes(cold)
+	if len(warmTimes) == 0 || len(coldTimes) == 0 {
+		fmt.Println("\nNot enough successful requests to compute the cost of a fresh socket")
+		return nil
+	}
+	fmt.Println("\nFresh socket cost (fresh vs warm):")
+	for _, p := range []float64{50, 75, 100} {
+		fmt.Printf("  %-4s %+d μs\n", percentileLabel(p), percentile(coldTimes, p)-percentile(warmTimes, p))
+	}
+	return nil
+}
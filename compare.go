@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type comparisonRow struct {
+	label   string
+	results []result
+	// uri is the STUN or TURN URI of the target, where rows are servers.
+	uri string
+}
+
+// printComparison prints one summary line per labelled result set so runs
+// against different targets or paths can be read side by side.
+func printComparison(rows []comparisonRow) {
+	width := len("Target")
+	for _, row := range rows {
+		if len(row.label) > width {
+			width = len(row.label)
+		}
+	}
+	line := strings.Repeat("─", width+2)
+
+	fmt.Printf("┌%s┬────────┬────────┬───────────┬───────────┬───────────┐\n", line)
+	fmt.Printf("│ %-*s │   OK   │ Failed │ p50 (μs)  │ p75 (μs)  │ p100 (μs) │\n", width, "Target")
+	fmt.Printf("├%s┼────────┼────────┼───────────┼───────────┼───────────┤\n", line)
+	for _, row := range rows {
+		times := sortedSuccessfulTimes(row.results)
+		failed := len(row.results) - len(times)
+		if len(times) == 0 {
+			fmt.Printf("│ %-*s │ %6d │ %6d │ %9s │ %9s │ %9s │\n", width, row.label, 0, failed, "-", "-", "-")
+			continue
+		}
+		fmt.Printf("│ %-*s │ %6d │ %6d │ %9d │ %9d │ %9d │\n", width, row.label, len(times), failed,
+			percentile(times, 50), percentile(times, 75), times[len(times)-1])
+	}
+	fmt.Printf("└%s┴────────┴────────┴───────────┴───────────┴───────────┘\n", line)
+}
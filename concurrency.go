@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// runConcurrent runs cfg.runCount requests on each of workers independent
+// sockets at the same time and returns the results of each worker.
+func runConcurrent(cfg config, host string, workers int) ([][]result, error) {
+	workerCfg := cfg
+	workerCfg.quiet = true
+	workerCfg.hookOutput = cfg.logOutput()
+	workerCfg.hookMu = new(sync.Mutex)
+
+	perWorker := make([][]result, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg := workerCfg
+			// Each worker keeps its own realm and nonce.
+			if cfg.auth != nil {
+				auth := *cfg.auth
+				cfg.auth = &auth
+			}
+			perWorker[w], errs[w] = runSTUNRequests(cfg, host)
+		}()
+	}
+	wg.Wait()
+
+	return perWorker, errors.Join(errs...)
+}
+
+func mergeResults(perWorker [][]result) []result {
+	var merged []result
+	for _, results := range perWorker {
+		merged = append(merged, results...)
+	}
+	return merged
+}
+
+// runWorkers runs cfg.runCount requests on each of cfg.concurrency sockets
+// at the same time, prints each worker's stats and returns all results in
+// the order they were sent for the aggregate report.
+func runWorkers(cfg config, host string) ([]result, error) {
+	fmt.Fprintf(cfg.logOutput(), "Starting %d workers...\n", cfg.concurrency)
+	perWorker, err := runConcurrent(cfg, host, cfg.concurrency)
+	if err != nil {
+		return nil, err
+	}
+	printWorkers(cfg.logOutput(), perWorker)
+
+	results := mergeResults(perWorker)
+	sort.SliceStable(results, func(i, j int) bool { return results[i].start.Before(results[j].start) })
+	for i := range results {
+		results[i].index = i
+	}
+	return results, nil
+}
+
+func printWorkers(w io.Writer, perWorker [][]result) {
+	fmt.Fprintln(w, "┌────────┬────────┬────────┬───────────┬───────────┬───────────┐")
+	fmt.Fprintln(w, "│ Worker │   OK   │ Failed │ p50 (μs)  │ p95 (μs)  │ p99 (μs)  │")
+	fmt.Fprintln(w, "├────────┼────────┼────────┼───────────┼───────────┼───────────┤")
+	row := func(name string, results []result) {
+		times := sortedSuccessfulTimes(results)
+		failed := len(results) - len(times)
+		if len(times) == 0 {
+			fmt.Fprintf(w, "│ %6s │ %6d │ %6d │ %9s │ %9s │ %9s │\n", name, 0, failed, "-", "-", "-")
+			return
+		}
+		fmt.Fprintf(w, "│ %6s │ %6d │ %6d │ %9d │ %9d │ %9d │\n", name, len(times), failed,
+			percentile(times, 50), percentile(times, 95), percentile(times, 99))
+	}
+	for i, results := range perWorker {
+		row(strconv.Itoa(i+1), results)
+	}
+	fmt.Fprintln(w, "├────────┼────────┼────────┼───────────┼───────────┼───────────┤")
+	row("All", mergeResults(perWorker))
+	fmt.Fprintln(w, "└────────┴────────┴────────┴───────────┴───────────┴───────────┘")
+}
+
+// runConcurrencyRamp doubles the number of concurrent workers up to
+// cfg.rampConcurrency and reports where latency starts to climb.
+func runConcurrencyRamp(cfg config) error {
+	fmt.Println("┌─────────────┬────────┬────────┬───────────┬───────────┐")
+	fmt.Println("│ Concurrency │   OK   │ Failed │ p50 (μs)  │ p95 (μs)  │")
+	fmt.Println("├─────────────┼────────┼────────┼───────────┼───────────┤")
+
+	var baseline50, baseline95 int64
+	knee := 0
+	for level := 1; level <= cfg.rampConcurrency; level *= 2 {
+		perWorker, err := runConcurrent(cfg, cfg.stunHost, level)
+		if err != nil {
+			return fmt.Errorf("concurrency %d: %w", level, err)
+		}
+		results := mergeResults(perWorker)
+
+		times := sortedSuccessfulTimes(results)
+		failed := len(results) - len(times)
+		if len(times) == 0 {
+			fmt.Printf("│ %11d │ %6d │ %6d │ %9s │ %9s │\n", level, 0, failed, "-", "-")
+			continue
+		}
+
+		p50, p95 := percentile(times, 50), percentile(times, 95)
+		fmt.Printf("│ %11d │ %6d │ %6d │ %9d │ %9d │\n", level, len(times), failed, p50, p95)
+
+		if baseline50 == 0 {
+			baseline50, baseline95 = p50, p95
+		} else if knee == 0 && (float64(p50) > float64(baseline50)*kneeFactor || float64(p95) > float64(baseline95)*kneeFactor) {
+			knee = level
+		}
+	}
+	fmt.Println("└─────────────┴────────┴────────┴───────────┴───────────┘")
+
+	if knee > 0 {
+		fmt.Printf("\nLatency knee at concurrency %d (p50 or p95 more than %.1fx the single-worker value)\n", knee, kneeFactor)
+	} else {
+		fmt.Println("\nNo latency knee found within the tested concurrency levels")
+	}
+	return nil
+}
+
+// kneeFactor is how much p50 or p95 may grow over the single-worker value
+// before a concurrency level is considered saturated.
+const kneeFactor = 1.5
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// defaultCSVFields are the -csv columns when -fields is not given.
+var defaultCSVFields = []string{"index", "timestamp", "rtt", "error"}
+
+// writeCSV writes one row per sample with the given fields as columns.
+func writeCSV(path string, fields []sampleField, host string, results []result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		header[i] = field.name
+	}
+	w.Write(header)
+
+	row := make([]string, len(fields))
+	for _, r := range results {
+		for i, field := range fields {
+			row[i] = fmt.Sprint(field.value(host, r))
+		}
+		w.Write(row)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// digestSubBuckets is how many buckets every power of two is split into.
+// Values below 2*digestSubBuckets are counted exactly; above that a bucket
+// spans less than 1/digestSubBuckets of its value, which bounds the
+// relative error of a percentile.
+const digestSubBuckets = 128
+
+// rttDigest counts RTTs in log-linear buckets, like HdrHistogram, so that
+// percentiles over any number of samples take a few kilobytes instead of
+// keeping and sorting every sample.
+type rttDigest struct {
+	counts   []int64
+	total    int64
+	min, max int64
+	sum      float64
+	sumSq    float64
+}
+
+func digestBucket(v int64) int {
+	if v < 2*digestSubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - bits.Len64(digestSubBuckets)
+	return (shift+1)*digestSubBuckets + int(v>>shift) - digestSubBuckets
+}
+
+// digestValue returns the midpoint of the values counted in bucket i.
+func digestValue(i int) int64 {
+	if i < 2*digestSubBuckets {
+		return int64(i)
+	}
+	shift := i/digestSubBuckets - 1
+	m := int64(i%digestSubBuckets + digestSubBuckets)
+	return m<<shift + (int64(1)<<shift)/2
+}
+
+func (d *rttDigest) add(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	i := digestBucket(v)
+	if i >= len(d.counts) {
+		d.counts = append(d.counts, make([]int64, i+1-len(d.counts))...)
+	}
+	d.counts[i]++
+	if d.total == 0 || v < d.min {
+		d.min = v
+	}
+	if v > d.max {
+		d.max = v
+	}
+	d.total++
+	d.sum += float64(v)
+	d.sumSq += float64(v) * float64(v)
+}
+
+func (d *rttDigest) mean() float64 {
+	return d.sum / float64(d.total)
+}
+
+// stddev returns the sample standard deviation of the values added.
+func (d *rttDigest) stddev() float64 {
+	if d.total < 2 {
+		return 0
+	}
+	m := d.mean()
+	return math.Sqrt(max(d.sumSq-float64(d.total)*m*m, 0) / float64(d.total-1))
+}
+
+// percentile returns the p-th percentile, within the relative error of a
+// bucket and never outside the smallest and largest value added.
+func (d *rttDigest) percentile(p float64) int64 {
+	if d.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(d.total)))
+	var seen int64
+	for i, c := range d.counts {
+		seen += c
+		if seen >= max(rank, 1) {
+			return min(max(digestValue(i), d.min), d.max)
+		}
+	}
+	return d.max
+}
+
+// summary formats the digest's percentiles as a suffix for a summary line,
+// or nothing if it is empty.
+func (d *rttDigest) summary() string {
+	if d.total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", p50 %d μs, p90 %d μs, p99 %d μs, max %d μs",
+		d.percentile(50), d.percentile(90), d.percentile(99), d.max)
+}
+
+// digestRun summarizes a -digest run as its results come in. It sees the
+// same samples as printResults: the first success is the cold start and is
+// left out of the statistics, unless the run warmed up or it stays the only
+// success.
+type digestRun struct {
+	warmedUp bool
+
+	successful, failed, incomplete int
+	firstErr                       error
+	nat                            string
+
+	// cold is the first successful RTT, held back until a second success
+	// shows it is not the only sample.
+	cold    int64
+	hasCold bool
+
+	rtts   rttDigest
+	jitter float64
+	last   int64
+}
+
+func (d *digestRun) add(r result) {
+	if r.err != nil {
+		if d.firstErr == nil {
+			d.firstErr = r.err
+		}
+		var ie *incompleteError
+		if errors.As(r.err, &ie) {
+			d.incomplete++
+		} else {
+			d.failed++
+		}
+		return
+	}
+	d.successful++
+	if d.nat == "" && r.local != nil && r.mapped != nil {
+		d.nat = natVerdict(r.local, r.mapped.IP)
+	}
+	if d.successful == 1 && !d.warmedUp {
+		d.cold, d.hasCold = r.time, true
+		return
+	}
+	d.addWarm(r.time)
+}
+
+// addWarm adds a warm RTT, updating the RFC 3550 jitter in the order the
+// samples were taken.
+func (d *digestRun) addWarm(t int64) {
+	if d.rtts.total > 0 {
+		d.jitter += (math.Abs(float64(t-d.last)) - d.jitter) / 16
+	}
+	d.last = t
+	d.rtts.add(t)
+}
+
+// print reports the run like printResults, from the digest.
+func (d *digestRun) print(cfg config) {
+	if d.successful == 0 {
+		fmt.Println("No successful requests")
+		if d.firstErr != nil {
+			fmt.Printf("First error: %v\n", d.firstErr)
+		}
+		if d.incomplete > 0 {
+			fmt.Printf("Incomplete responses: %d\n", d.incomplete)
+		}
+		return
+	}
+	// A lone success is the only sample there is, not a cold start.
+	if d.hasCold && d.rtts.total == 0 {
+		d.addWarm(d.cold)
+		d.hasCold = false
+	}
+	nat := d.nat
+	if nat == "" {
+		nat = natVerdict(nil, nil)
+	}
+
+	fmt.Println("\nResults:")
+	fmt.Printf("Successful requests: %d\n", d.successful)
+	fmt.Printf("Failed requests: %d\n", d.failed)
+	if d.incomplete > 0 {
+		fmt.Printf("Incomplete responses: %d\n", d.incomplete)
+	}
+	if d.hasCold {
+		fmt.Printf("Cold-start RTT: %d μs\n", d.cold)
+	}
+	fmt.Printf("NAT: %s\n", nat)
+	fmt.Println()
+
+	if d.hasCold {
+		fmt.Println("Warm requests:")
+	}
+	fmt.Println("┌───────┬───────────┐")
+	fmt.Printf("│ %%tile │ Time (μs) │\n")
+	fmt.Println("├───────┼───────────┤")
+	for _, p := range cfg.tablePercentiles {
+		fmt.Printf("│ %-5s │ %9d │\n", percentileCell(p), d.rtts.percentile(p))
+	}
+	fmt.Println("└───────┴───────────┘")
+
+	m, sd := d.rtts.mean(), d.rtts.stddev()
+	fmt.Printf("\nMean: %.0f μs\n", m)
+	fmt.Printf("Std dev: %.0f μs\n", sd)
+	fmt.Printf("Jitter (RFC 3550): %.0f μs\n", d.jitter)
+	if cfg.showCV {
+		fmt.Printf("Coefficient of variation: %.3f\n", sd/m)
+	}
+}
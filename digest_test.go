@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestDigestBucket(t *testing.T) {
+	tests := []struct {
+		v      int64
+		bucket int
+	}{
+		{0, 0},
+		{255, 255},
+		{256, 256},
+		{257, 256},
+		{258, 257},
+		{511, 383},
+		{512, 384},
+		{515, 384},
+		{516, 385},
+	}
+	for _, tt := range tests {
+		if got := digestBucket(tt.v); got != tt.bucket {
+			t.Errorf("digestBucket(%d) = %d, want %d", tt.v, got, tt.bucket)
+		}
+	}
+}
+
+func TestDigestValue(t *testing.T) {
+	tests := []struct {
+		bucket int
+		v      int64
+	}{
+		{0, 0},
+		{255, 255},
+		{256, 257},
+		{383, 511},
+		{384, 514},
+	}
+	for _, tt := range tests {
+		if got := digestValue(tt.bucket); got != tt.v {
+			t.Errorf("digestValue(%d) = %d, want %d", tt.bucket, got, tt.v)
+		}
+	}
+	// Every bucket's value falls back into that bucket.
+	for i := 0; i < 20*digestSubBuckets; i++ {
+		if got := digestBucket(digestValue(i)); got != i {
+			t.Fatalf("digestBucket(digestValue(%d)) = %d", i, got)
+		}
+	}
+}
+
+func TestDigestPercentile(t *testing.T) {
+	var d rttDigest
+	for v := int64(1); v <= 100; v++ {
+		d.add(v)
+	}
+	tests := []struct {
+		p    float64
+		want int64
+	}{
+		{0, 1},
+		{50, 50},
+		{99, 99},
+		{100, 100},
+	}
+	for _, tt := range tests {
+		if got := d.percentile(tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestDigestStddev(t *testing.T) {
+	var d rttDigest
+	times := []int64{1000, 1200, 900, 1500, 1100}
+	for _, v := range times {
+		d.add(v)
+	}
+	if got, want := d.stddev(), stddev(times); math.Abs(got-want) > 1e-6 {
+		t.Errorf("stddev() = %v, want %v", got, want)
+	}
+}
+
+// TestDigestRun checks that a -digest run sees the same samples as
+// printResults.
+func TestDigestRun(t *testing.T) {
+	failed := errors.New("timeout")
+	tests := []struct {
+		name     string
+		times    []int64
+		warmedUp bool
+		cold     bool
+		total    int64
+		jitter   float64
+	}{
+		{"cold start left out", []int64{5000, 100, 300, 200}, false, true, 3, (200.0/16)*15/16 + 100.0/16},
+		{"after a warm-up", []int64{5000, 100}, true, false, 2, 4900.0 / 16},
+		{"lone success", []int64{5000}, false, false, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &digestRun{warmedUp: tt.warmedUp}
+			d.add(result{err: failed})
+			for _, v := range tt.times {
+				d.add(result{time: v})
+			}
+			// print settles a lone success into the digest.
+			d.print(config{})
+			if d.hasCold != tt.cold || d.rtts.total != tt.total || d.failed != 1 {
+				t.Errorf("cold %v, %d samples, %d failed; want cold %v, %d samples, 1 failed", d.hasCold, d.rtts.total, d.failed, tt.cold, tt.total)
+			}
+			if math.Abs(d.jitter-tt.jitter) > 1e-9 {
+				t.Errorf("jitter = %v, want %v", d.jitter, tt.jitter)
+			}
+			if tt.cold && d.cold != tt.times[0] {
+				t.Errorf("cold start = %d, want %d", d.cold, tt.times[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// discoverRuns is how many requests -discover sends to each server unless
+// -runs is set.
+const discoverRuns = 10
+
+// publicSTUNServers is the built-in list -discover probes, in the -targets
+// file format: well-known public servers run by large operators, which are
+// the likeliest to still be around.
+const publicSTUNServers = `
+stun.cloudflare.com:3478 Cloudflare
+stun.l.google.com:19302 Google
+stun1.l.google.com:19302 Google 1
+stun2.l.google.com:19302 Google 2
+stun3.l.google.com:19302 Google 3
+stun4.l.google.com:19302 Google 4
+global.stun.twilio.com:3478 Twilio
+stun.nextcloud.com:443 Nextcloud
+stun.sipgate.net:3478 sipgate
+stun.voipgate.com:3478 VoIPgate
+stun.stunprotocol.org:3478 stunprotocol.org
+`
+
+// discoveryTargets returns the servers -discover probes: the list at url if
+// one is given, else the built-in list.
+func discoveryTargets(url, transport string) ([]target, error) {
+	if url == "" {
+		return parseTargets(strings.NewReader(publicSTUNServers), "built-in server list", transport)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch server list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch server list: %s", resp.Status)
+	}
+	return parseTargets(resp.Body, url, transport)
+}
+
+// runDiscover probes every server on the public list and ranks them, for
+// users who do not know which servers to try. Servers that cannot be
+// reached are skipped.
+func runDiscover(cfg config) error {
+	targets, err := discoveryTargets(cfg.discoverURL, cfg.transport)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cfg.logOutput(), "Probing %d public STUN servers with %d requests each\n", len(targets), cfg.runCount)
+	return measureTargets(cfg, targets, true)
+}
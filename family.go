@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pion/stun"
+)
+
+func addrFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// lookupFamily resolves host to its addresses of the given IP version, or
+// of either version when it is 0.
+func lookupFamily(ctx context.Context, host string, version int) ([]net.IP, error) {
+	if version == 0 {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+		return ips, nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, fmt.Sprintf("ip%d", version), host)
+	if err != nil {
+		return nil, fmt.Errorf("%s has no IPv%d address: %w", host, version, err)
+	}
+	return ips, nil
+}
+
+// resolveFamily resolves the host of hostport to an address of the IP
+// version selected with -4 or -6, so the socket is dialed over that family
+// rather than whichever the resolver returns first. With neither selected,
+// hostport is returned as is for the dialer to resolve.
+func resolveFamily(hostport string, version int) (string, error) {
+	if version == 0 {
+		return hostport, nil
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %w", hostport, err)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if addrFamily(ip) != fmt.Sprintf("IPv%d", version) {
+			return "", fmt.Errorf("%s is not an IPv%d address", host, version)
+		}
+		return hostport, nil
+	}
+	ips, err := lookupFamily(context.Background(), host, version)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// printConnectionFamilies reports the address families the OS actually chose
+// for conn. For dual-stack servers that choice depends on local routing and
+// is otherwise invisible. resolved are the addresses host resolved to when
+// conn was dialed.
+func printConnectionFamilies(w io.Writer, conn net.Conn, host string, resolved []net.IP) {
+	localIP, _ := addrIPPort(conn.LocalAddr())
+	remoteIP, _ := addrIPPort(conn.RemoteAddr())
+	fmt.Fprintf(w, "Local address: %s (%s)\n", conn.LocalAddr(), addrFamily(localIP))
+	fmt.Fprintf(w, "Remote address: %s (%s)\n", conn.RemoteAddr(), addrFamily(remoteIP))
+
+	var v4, v6 bool
+	for _, ip := range resolved {
+		if ip.To4() != nil {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	if v4 && v6 {
+		fmt.Fprintf(w, "%s is dual-stack; the connection uses %s\n", host, addrFamily(remoteIP))
+	}
+}
+
+// splitSTUNHost returns the host and port of a single -host value, read the
+// way newProber reads it, so that the port defaults to 3478.
+func splitSTUNHost(s string) (host, port string, err error) {
+	if strings.Contains(s, ",") {
+		return "", "", fmt.Errorf("this mode measures one host, not a list (got %q)", s)
+	}
+	u, err := stun.ParseURI("stun:" + s)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	return u.Host, strconv.Itoa(u.Port), nil
+}
+
+// runEachIP resolves the host and measures every address it resolves to in
+// turn, ranking them like separate servers. Anycast and multi-POP services
+// publish several addresses that can differ widely in latency.
+func runEachIP(cfg config) error {
+	host, port, err := splitSTUNHost(cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	ips, err := lookupFamily(context.Background(), host, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cfg.logOutput(), "%s resolves to %d addresses\n", host, len(ips))
+
+	rows, err := measureIPs(cfg, host, port, ips, func(ip net.IP) string {
+		return fmt.Sprintf("%s (%s)", ip, addrFamily(ip))
+	}, false)
+	if err != nil {
+		return err
+	}
+	return reportHosts(cfg, rows)
+}
+
+// runDualStack measures the host over IPv4 and IPv6, one address of each,
+// and ranks the two families so the recommendation says which path the
+// network should prefer. A family the host has no address for, or that the
+// local network cannot reach, is reported and left out.
+func runDualStack(cfg config) error {
+	host, port, err := splitSTUNHost(cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	ips, err := lookupFamily(context.Background(), host, 0)
+	if err != nil {
+		return err
+	}
+	var v4, v6 net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil && v4 == nil {
+			v4 = ip
+		} else if ip.To4() == nil && v6 == nil {
+			v6 = ip
+		}
+	}
+	var picked []net.IP
+	for _, ip := range []net.IP{v4, v6} {
+		if ip != nil {
+			picked = append(picked, ip)
+		}
+	}
+	switch {
+	case v4 == nil:
+		fmt.Fprintf(os.Stderr, "%s has no IPv4 address; measuring IPv6 only\n", host)
+	case v6 == nil:
+		fmt.Fprintf(os.Stderr, "%s has no IPv6 address; measuring IPv4 only\n", host)
+	}
+
+	rows, err := measureIPs(cfg, host, port, picked, func(ip net.IP) string {
+		return fmt.Sprintf("%s (%s)", addrFamily(ip), ip)
+	}, true)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return errors.New("neither family could be measured")
+	}
+	return reportHosts(cfg, rows)
+}
+
+// measureIPs measures each of host's addresses ips in turn on port. With
+// skipFailed, an address that cannot be measured at all, e.g. because its
+// family has no route, is left out instead of ending the run.
+func measureIPs(cfg config, host, port string, ips []net.IP, label func(net.IP) string, skipFailed bool) ([]comparisonRow, error) {
+	// Certificates name the host, not its addresses.
+	if cfg.tlsServerName == "" && net.ParseIP(host) == nil {
+		cfg.tlsServerName = host
+	}
+	var rows []comparisonRow
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.String(), port)
+		fmt.Fprintf(cfg.logOutput(), "\n== %s ==\n", label(ip))
+		ipCfg := cfg
+		ipCfg.stunHost = addr
+		results, err := runSTUNRequests(ipCfg, addr)
+		if err != nil && skipFailed {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", label(ip), err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ip, err)
+		}
+		rows = append(rows, comparisonRow{label: label(ip), uri: stunURI(addr, cfg.transport), results: results})
+	}
+	return rows, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sampleField is one column of per-sample output, selectable with -fields.
+type sampleField struct {
+	name  string
+	value func(host string, r result) any
+}
+
+var sampleFields = []sampleField{
+	{"index", func(_ string, r result) any { return r.index }},
+	{"timestamp", func(_ string, r result) any { return r.start.Format(time.RFC3339Nano) }},
+	{"rtt", func(_ string, r result) any { return r.time }},
+	{"txid", func(_ string, r result) any { return fmt.Sprintf("%x", r.txid) }},
+	{"host", func(host string, _ result) any { return host }},
+	{"error", func(_ string, r result) any {
+		if r.err == nil {
+			return ""
+		}
+		return r.err.Error()
+	}},
+	{"local", func(_ string, r result) any {
+		if r.local == nil {
+			return ""
+		}
+		return r.local.String()
+	}},
+	{"mapped", func(_ string, r result) any {
+		if r.mapped == nil {
+			return ""
+		}
+		return r.mapped.String()
+	}},
+	{"size", func(_ string, r result) any { return r.size }},
+}
+
+func parseFields(s string) ([]sampleField, error) {
+	var fields []sampleField
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, f := range sampleFields {
+			if f.name == name {
+				fields = append(fields, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			valid := make([]string, len(sampleFields))
+			for i, f := range sampleFields {
+				valid[i] = f.name
+			}
+			return nil, fmt.Errorf("unknown field %q (valid fields: %s)", name, strings.Join(valid, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// sampleRecord is a single sample rendered with the selected fields. It
+// marshals to a JSON object whose keys keep the -fields order.
+type sampleRecord struct {
+	fields []sampleField
+	values []any
+}
+
+func newSampleRecord(fields []sampleField, host string, r result) sampleRecord {
+	values := make([]any, len(fields))
+	for i, f := range fields {
+		values[i] = f.value(host, r)
+	}
+	return sampleRecord{fields: fields, values: values}
+}
+
+func (s sampleRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range s.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.name)
+		value, err := json.Marshal(s.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
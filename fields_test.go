@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr string
+	}{
+		{in: "rtt", want: []string{"rtt"}},
+		{in: "index,timestamp,rtt,error", want: []string{"index", "timestamp", "rtt", "error"}},
+		{in: " mapped , size ", want: []string{"mapped", "size"}},
+		{in: "rtt,index,rtt", want: []string{"rtt", "index", "rtt"}},
+		{in: "rtt,latency", wantErr: `unknown field "latency"`},
+		{in: "", wantErr: `unknown field ""`},
+		{in: "RTT", wantErr: `unknown field "RTT"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			fields, err := parseFields(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, f := range fields {
+				names = append(names, f.name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fields = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+// TestSampleRecordOrder checks that a sample marshals with its keys in
+// -fields order rather than alphabetically.
+func TestSampleRecordOrder(t *testing.T) {
+	fields, err := parseFields("rtt,index,host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := newSampleRecord(fields, "stun.example:3478", result{index: 7, time: 1500}).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"rtt":1500,"index":7,"host":"stun.example:3478"}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
@@ -3,13 +3,13 @@ module github.com/renandincer/stun-timing
 go 1.22.2
 
 require (
+	github.com/pion/dtls/v2 v2.2.7
 	github.com/pion/stun v0.6.1
 	github.com/schollz/progressbar/v3 v3.16.0
 )
 
 require (
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/pion/dtls/v2 v2.2.7 // indirect
 	github.com/pion/logging v0.2.2 // indirect
 	github.com/pion/transport/v2 v2.2.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// hairpinResult is the outcome of sending a packet to the socket's own
+// mapped address.
+type hairpinResult struct {
+	mapped *net.UDPAddr
+	// noNAT is set when the mapped address is the local one, so the packet
+	// never passes through a NAT.
+	noNAT bool
+	rtt   time.Duration
+	err   error
+}
+
+func (h hairpinResult) String() string {
+	switch {
+	case h.noNAT:
+		return "not applicable (no NAT)"
+	case errors.Is(h.err, errNoResponse):
+		return "not supported"
+	case h.err != nil:
+		return fmt.Sprintf("unknown (%v)", h.err)
+	default:
+		return fmt.Sprintf("supported, %d μs", h.rtt.Microseconds())
+	}
+}
+
+// hairpin sends a Binding request to to, normally the socket's own mapped
+// address, and waits for the request itself to arrive back, retransmitting
+// like run.
+func (s *natSocket) hairpin(to *net.UDPAddr) (time.Duration, error) {
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < natAttempts; attempt++ {
+		start := time.Now()
+		if _, err := s.conn.WriteTo(req.Raw, to); err != nil {
+			return 0, err
+		}
+		s.conn.SetReadDeadline(start.Add(s.timeout / natAttempts))
+		for {
+			n, _, err := s.conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			m := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if m.Decode() == nil && m.TransactionID == req.TransactionID && m.Type == stun.BindingRequest {
+				return time.Since(start), nil
+			}
+		}
+	}
+	return 0, errNoResponse
+}
+
+// checkHairpin learns the mapped address of a fresh socket from server and
+// tests whether the NAT loops packets sent to it back to the socket (RFC
+// 5780, section 4.7).
+func checkHairpin(cfg config, server *net.UDPAddr) hairpinResult {
+	s, err := listenNAT(cfg)
+	if err != nil {
+		return hairpinResult{err: err}
+	}
+	defer s.Close()
+
+	t := &natTest{name: "Hairpin", to: server}
+	s.run(t)
+	if t.err != nil {
+		return hairpinResult{err: fmt.Errorf("failed to learn mapped address: %w", t.err)}
+	}
+
+	h := hairpinResult{mapped: t.mapped}
+	_, port := addrIPPort(s.conn.LocalAddr())
+	if sameAddr(t.mapped, &net.UDPAddr{IP: currentLocalIP(s.d, server), Port: port}) {
+		h.noNAT = true
+		return h
+	}
+	h.rtt, h.err = s.hairpin(t.mapped)
+	return h
+}
+
+// runHairpin reports whether the NAT hairpins packets sent to the socket's
+// own server-reflexive address, and how long the round trip takes.
+func runHairpin(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-hairpin needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+
+	h := checkHairpin(cfg, server)
+	if h.mapped != nil {
+		fmt.Printf("Mapped address: %s\n", h.mapped)
+	}
+	fmt.Printf("Hairpinning: %s\n", h)
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// hgrmTicksPerHalfDistance matches HdrHistogram's default output: five
+// percentile steps between each halving of the distance to 100%.
+const hgrmTicksPerHalfDistance = 5
+
+// writeHgrm writes the successful samples as an HdrHistogram percentile
+// distribution (.hgrm), with values in milliseconds. Percentiles are exact
+// rather than bucketed, since every sample is kept anyway.
+func writeHgrm(path string, results []result) error {
+	times := sortedSuccessfulTimes(results)
+	if len(times) == 0 {
+		return fmt.Errorf("no successful requests to write to %s", path)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create hgrm file: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	n := len(times)
+	ms := func(t int64) float64 { return float64(t) / 1000 }
+
+	fmt.Fprintf(w, "%12s %14s %10s %14s\n\n", "Value", "Percentile", "TotalCount", "1/(1-Percentile)")
+	for level := 0.0; ; {
+		// The smallest value with at least level percent of samples at or
+		// below it.
+		i := max(int(math.Ceil(level/100*float64(n)))-1, 0)
+		if i >= n-1 {
+			fmt.Fprintf(w, "%12.3f %1.12f %10d\n", ms(times[n-1]), 1.0, n)
+			break
+		}
+		count := sort.Search(n, func(j int) bool { return times[j] > times[i] })
+		fmt.Fprintf(w, "%12.3f %1.12f %10d %14.2f\n", ms(times[i]), level/100, count, 1/(1-level/100))
+
+		ticks := hgrmTicksPerHalfDistance * math.Pow(2, math.Floor(math.Log2(100/(100-level)))+1)
+		level += 100 / ticks
+	}
+
+	m, sd := mean(times), stddev(times)
+	fmt.Fprintf(w, "#[Mean    = %12.3f, StdDeviation   = %12.3f]\n", m/1000, sd/1000)
+	fmt.Fprintf(w, "#[Max     = %12.3f, Total count    = %12d]\n", ms(times[n-1]), n)
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write hgrm file: %w", err)
+	}
+	return nil
+}
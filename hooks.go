@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// responseHook is called once per request after its outcome is known. msg
+// is the response if one was received and otherwise the unanswered request,
+// so msg.TransactionID always identifies the request.
+//
+// Hooks run in registration order, after the RTT has been taken, so they
+// never inflate the measurement. In the default sequential mode they run on
+// the measuring goroutine in request order and a slow hook delays the next
+// request. With -reorder they run on the receiving goroutine in arrival
+// order, with requests that never got a response reported after the run;
+// they are never called concurrently with each other. -concurrency workers
+// share one lock for their hooks.
+type responseHook func(index int, msg *stun.Message, rtt time.Duration, err error)
+
+// responseHooks returns the per-response hooks for requests to host, from
+// the output options in cfg. It is the one place hooks are registered.
+func (cfg config) responseHooks(host string) []responseHook {
+	var hooks []responseHook
+	out := cfg.logOutput()
+	if cfg.hookOutput != nil {
+		out = cfg.hookOutput
+	}
+	if cfg.verbose {
+		hooks = append(hooks, verboseHook(out))
+	}
+	if cfg.stream {
+		hooks = append(hooks, streamHook(out))
+	}
+	if cfg.ndjson != nil {
+		hooks = append(hooks, ndjsonHook(cfg.ndjson, host))
+	}
+	if cfg.statsd != nil {
+		hooks = append(hooks, cfg.statsd.hook(host))
+	}
+	if cfg.hookMu != nil && len(hooks) > 0 {
+		return []responseHook{lockedHooks(cfg.hookMu, hooks)}
+	}
+	return hooks
+}
+
+// lockedHooks runs hooks in turn while holding mu.
+func lockedHooks(mu *sync.Mutex, hooks []responseHook) responseHook {
+	return func(index int, msg *stun.Message, rtt time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, h := range hooks {
+			h(index, msg, rtt, err)
+		}
+	}
+}
+
+func runHooks(hooks []responseHook, r result, msg *stun.Message) {
+	rtt := time.Duration(r.time) * time.Microsecond
+	for _, h := range hooks {
+		h(r.index, msg, rtt, r.err)
+	}
+}
+
+// verboseHook prints the transaction ID and RTT of every request.
+func verboseHook(w io.Writer) responseHook {
+	return func(_ int, msg *stun.Message, rtt time.Duration, err error) {
+		if err != nil {
+			fmt.Fprintf(w, "txid=%x rtt=%dμs err=%v\n", msg.TransactionID, rtt.Microseconds(), err)
+			return
+		}
+		fmt.Fprintf(w, "txid=%x rtt=%dμs\n", msg.TransactionID, rtt.Microseconds())
+	}
+}
+
+// streamHook prints one row of the -stream table per request.
+func streamHook(w io.Writer) responseHook {
+	return func(index int, _ *stun.Message, rtt time.Duration, err error) {
+		if err != nil {
+			fmt.Fprintf(w, "%6d  %10s  %v\n", index, "-", err)
+			return
+		}
+		fmt.Fprintf(w, "%6d  %7d μs\n", index, rtt.Microseconds())
+	}
+}
+
+// ndjsonSample is one line of -format ndjson output.
+type ndjsonSample struct {
+	Index  int    `json:"index"`
+	Time   string `json:"time"`
+	Host   string `json:"host"`
+	TxID   string `json:"txid"`
+	RTT    int64  `json:"rtt_us,omitempty"`
+	Mapped string `json:"mapped,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ndjsonHook writes one JSON object per request as soon as it completes, so
+// long runs can be piped into jq or a log shipper.
+func ndjsonHook(w io.Writer, host string) responseHook {
+	enc := json.NewEncoder(w)
+	return func(index int, msg *stun.Message, rtt time.Duration, err error) {
+		sample := ndjsonSample{
+			Index: index,
+			Time:  time.Now().Format(time.RFC3339Nano),
+			Host:  host,
+			TxID:  fmt.Sprintf("%x", msg.TransactionID),
+		}
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			sample.RTT = rtt.Microseconds()
+			var xorAddr stun.XORMappedAddress
+			if xorAddr.GetFrom(msg) == nil {
+				sample.Mapped = xorAddr.String()
+			}
+		}
+		enc.Encode(sample)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+)
+
+type htmlSample struct {
+	// Offset is when the request was sent, in seconds since the first one.
+	Offset float64 `json:"s"`
+	Time   int64   `json:"t"`
+	Failed bool    `json:"f,omitempty"`
+}
+
+type htmlMetadata struct {
+	Name  string
+	Value string
+}
+
+type htmlBucket struct {
+	histogramBucket
+	Width int
+}
+
+type htmlReport struct {
+	Host        string
+	Generated   string
+	Successful  int
+	Failed      int
+	Percentiles []jsonPercentile
+	Histogram   []htmlBucket
+	Samples     []htmlSample
+	Metadata    []htmlMetadata
+}
+
+// htmlTemplate renders a self-contained page: no external scripts, styles or
+// fonts, so the file can be attached to a ticket and opened offline.
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>STUN timing: {{.Host}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+.bar { background: #4a7bd0; height: 12px; }
+td.barcell { text-align: left; width: 400px; }
+canvas { border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>STUN timing: {{.Host}}</h1>
+<p>Generated {{.Generated}}. Successful requests: {{.Successful}}. Failed requests: {{.Failed}}.</p>
+
+<h2>Run</h2>
+<table>
+{{range .Metadata}}<tr><th>{{.Name}}</th><td style="text-align: left">{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Percentiles</h2>
+<table>
+<tr><th>%tile</th><th>Time (μs)</th></tr>
+{{range .Percentiles}}<tr><td>p{{.Percentile}}</td><td>{{.Time}}</td></tr>
+{{end}}</table>
+
+<h2>Latency distribution</h2>
+<table>
+<tr><th>From (μs)</th><th>To (μs)</th><th></th><th>Count</th></tr>
+{{range .Histogram}}<tr><td>{{.Start}}</td><td>{{.End}}</td><td class="barcell"><div class="bar" style="width: {{.Width}}%"></div></td><td>{{.Count}}</td></tr>
+{{end}}</table>
+
+<h2>RTT over time</h2>
+<canvas id="samples" width="900" height="300"></canvas>
+<script>
+const samples = {{.Samples}};
+const canvas = document.getElementById("samples");
+const ctx = canvas.getContext("2d");
+if (samples.length > 0) {
+  const maxS = Math.max(0.001, samples[samples.length - 1].s);
+  const maxT = Math.max(1, ...samples.map(s => s.t));
+  const pad = 40;
+  const x = s => pad + (canvas.width - 2 * pad) * s / maxS;
+  const y = t => canvas.height - pad - (canvas.height - 2 * pad) * t / maxT;
+  ctx.strokeStyle = "#999";
+  ctx.beginPath();
+  ctx.moveTo(pad, pad);
+  ctx.lineTo(pad, canvas.height - pad);
+  ctx.lineTo(canvas.width - pad, canvas.height - pad);
+  ctx.stroke();
+  ctx.fillStyle = "#222";
+  ctx.fillText(maxT + " μs", 2, pad);
+  ctx.fillText(maxS.toFixed(1) + " s", canvas.width - pad - 20, canvas.height - pad + 20);
+  ctx.strokeStyle = "#4a7bd0";
+  ctx.beginPath();
+  let drawing = false;
+  for (const s of samples) {
+    if (s.f) {
+      drawing = false;
+      continue;
+    }
+    if (drawing) {
+      ctx.lineTo(x(s.s), y(s.t));
+    } else {
+      ctx.moveTo(x(s.s), y(s.t));
+      drawing = true;
+    }
+  }
+  ctx.stroke();
+  // Failed requests are marked in red along the time axis.
+  ctx.fillStyle = "#d04a4a";
+  for (const s of samples.filter(s => s.f)) {
+    ctx.fillRect(x(s.s) - 1, canvas.height - pad - 6, 2, 6);
+  }
+}
+</script>
+</body>
+</html>
+`))
+
+// htmlRunMetadata describes how and where the run was made, so a report
+// attached to a ticket stands on its own.
+func htmlRunMetadata(cfg config, results []result, summary jsonReport) []htmlMetadata {
+	hostname, _ := os.Hostname()
+	meta := []htmlMetadata{
+		{"Target", cfg.stunHost},
+		{"Measured from", hostname},
+	}
+	if len(results) > 0 {
+		first, last := results[0], results[len(results)-1]
+		meta = append(meta,
+			htmlMetadata{"Started", first.start.Format(time.RFC1123)},
+			htmlMetadata{"Duration", last.start.Add(time.Duration(last.time) * time.Microsecond).Sub(first.start).Round(time.Millisecond).String()},
+		)
+		if first.local != nil {
+			meta = append(meta, htmlMetadata{"Local address", first.local.String()})
+		}
+	}
+	if summary.MappedIP != "" {
+		meta = append(meta, htmlMetadata{"Mapped IP", summary.MappedIP})
+	}
+	if summary.ColdStart != nil {
+		meta = append(meta, htmlMetadata{"Cold-start RTT", fmt.Sprintf("%d μs", *summary.ColdStart)})
+	}
+	meta = append(meta,
+		htmlMetadata{"Requests", fmt.Sprint(len(results))},
+		htmlMetadata{"Timeout", cfg.timeout.String()},
+		htmlMetadata{"Command", currentInvocation().command()},
+	)
+	return meta
+}
+
+func writeHTMLReport(path string, cfg config, results []result) error {
+	summary := buildJSONReport(results, cfg.tablePercentiles, cfg.warmup > 0)
+	report := htmlReport{
+		Host:        cfg.stunHost,
+		Generated:   time.Now().Format(time.RFC1123),
+		Successful:  summary.Successful,
+		Failed:      summary.Failed,
+		Percentiles: summary.Percentiles,
+	}
+
+	maxCount := 0
+	for _, b := range summary.Histogram {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	for _, b := range summary.Histogram {
+		report.Histogram = append(report.Histogram, htmlBucket{histogramBucket: b, Width: b.Count * 100 / maxCount})
+	}
+
+	for _, r := range results {
+		report.Samples = append(report.Samples, htmlSample{
+			Offset: r.start.Sub(results[0].start).Seconds(),
+			Time:   r.time,
+			Failed: r.err != nil,
+		})
+	}
+	report.Metadata = htmlRunMetadata(cfg, results, summary)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create HTML report: %w", err)
+	}
+	defer f.Close()
+
+	if err := htmlTemplate.Execute(f, report); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
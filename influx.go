@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// parseInfluxTags parses "key=value,key=value" into tag pairs.
+func parseInfluxTags(s string) ([][2]string, error) {
+	var tags [][2]string
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid tag %q (want key=value)", pair)
+		}
+		tags = append(tags, [2]string{key, value})
+	}
+	return tags, nil
+}
+
+// influxLines renders every sample, plus a summary point, as InfluxDB line
+// protocol. Samples are timestamped with their start time and the summary
+// with the end of the run.
+func influxLines(cfg config, results []result) []byte {
+	var b bytes.Buffer
+
+	measurement := influxMeasurementEscaper.Replace(cfg.influxMeasurement)
+	tags := "host=" + influxTagEscaper.Replace(cfg.stunHost)
+	for _, tag := range cfg.influxTags {
+		tags += "," + influxTagEscaper.Replace(tag[0]) + "=" + influxTagEscaper.Replace(tag[1])
+	}
+	series := measurement + "," + tags
+
+	var successfulTimes []int64
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Fprintf(&b, "%s success=false,error=\"%s\" %d\n", series, influxStringEscaper.Replace(r.err.Error()), r.start.UnixNano())
+			continue
+		}
+		successfulTimes = append(successfulTimes, r.time)
+		fmt.Fprintf(&b, "%s success=true,rtt_us=%di %d\n", series, r.time, r.start.UnixNano())
+	}
+
+	fields := []string{
+		"successful=" + strconv.Itoa(len(successfulTimes)) + "i",
+		"failed=" + strconv.Itoa(len(results)-len(successfulTimes)) + "i",
+	}
+	if len(successfulTimes) > 0 {
+		sort.Slice(successfulTimes, func(i, j int) bool { return successfulTimes[i] < successfulTimes[j] })
+		for _, p := range cfg.exportPercentiles {
+			name := strings.ReplaceAll(percentileLabel(p), ".", "_")
+			fields = append(fields, fmt.Sprintf("%s_us=%di", name, percentile(successfulTimes, p)))
+		}
+	}
+	fmt.Fprintf(&b, "%s_summary,%s %s %d\n", measurement, tags, strings.Join(fields, ","), time.Now().UnixNano())
+
+	return b.Bytes()
+}
+
+// writeInflux prints the line protocol to stdout, or posts it to an InfluxDB
+// write endpoint when cfg.influxURL is set.
+func writeInflux(cfg config, results []result) error {
+	lines := influxLines(cfg, results)
+	if cfg.influxURL == "" {
+		_, err := os.Stdout.Write(lines)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.influxURL, bytes.NewReader(lines))
+	if err != nil {
+		return fmt.Errorf("failed to create InfluxDB request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token := os.Getenv("INFLUX_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB write failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	fmt.Fprintf(cfg.logOutput(), "Wrote %d samples to %s\n", len(results), cfg.influxURL)
+	return nil
+}
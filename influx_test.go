@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		replacer *strings.Replacer
+		in, want string
+	}{
+		{"measurement", influxMeasurementEscaper, "stun rtt,v2", `stun\ rtt\,v2`},
+		{"measurement keeps =", influxMeasurementEscaper, "a=b", "a=b"},
+		{"tag", influxTagEscaper, "a b,c=d", `a\ b\,c\=d`},
+		{"tag keeps quotes", influxTagEscaper, `"x"`, `"x"`},
+		{"string", influxStringEscaper, `say "hi" \o/`, `say \"hi\" \\o/`},
+		{"string keeps spaces and commas", influxStringEscaper, "a b,c", "a b,c"},
+	}
+	for _, tt := range tests {
+		if got := tt.replacer.Replace(tt.in); got != tt.want {
+			t.Errorf("%s: Replace(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestInfluxLines(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	cfg := config{
+		stunHost:          "stun.example:3478",
+		influxMeasurement: "stun rtt",
+		influxTags:        [][2]string{{"site", "lab 1"}, {"path", "a=b,c"}},
+		exportPercentiles: []float64{50, 99.9},
+	}
+	results := []result{
+		{start: start, time: 1200},
+		{start: start.Add(time.Second), err: errors.New(`Binding failed: 400 "Bad" \ Request`)},
+		{start: start.Add(2 * time.Second), time: 1800},
+	}
+	lines := strings.Split(strings.TrimSuffix(string(influxLines(cfg, results)), "\n"), "\n")
+
+	series := `stun\ rtt,host=stun.example:3478,site=lab\ 1,path=a\=b\,c`
+	want := []string{
+		series + " success=true,rtt_us=1200i 1700000000000000000",
+		series + ` success=false,error="Binding failed: 400 \"Bad\" \\ Request" 1700000001000000000`,
+		series + " success=true,rtt_us=1800i 1700000002000000000",
+	}
+	if len(lines) != len(want)+1 {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want)+1, strings.Join(lines, "\n"))
+	}
+	for i, w := range want {
+		if lines[i] != w {
+			t.Errorf("line %d = %s, want %s", i, lines[i], w)
+		}
+	}
+	summary := `stun\ rtt_summary,host=stun.example:3478,site=lab\ 1,path=a\=b\,c successful=2i,failed=1i,p50_us=1500i,p99_9_us=1799i `
+	if !strings.HasPrefix(lines[3], summary) {
+		t.Errorf("summary = %s, want prefix %s", lines[3], summary)
+	}
+}
+
+func TestParseInfluxTags(t *testing.T) {
+	tags, err := parseInfluxTags("site=lab,region=eu-west")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != [2]string{"site", "lab"} || tags[1] != [2]string{"region", "eu-west"} {
+		t.Errorf("tags = %v", tags)
+	}
+	for _, s := range []string{"site", "=lab", "site=", "site=lab,"} {
+		if _, err := parseInfluxTags(s); err == nil {
+			t.Errorf("parseInfluxTags(%q): expected an error", s)
+		}
+	}
+}
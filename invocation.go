@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// invocation is the flag set a run was started with, saved in reports so
+// that whoever receives one can rerun the same measurement.
+type invocation struct {
+	// Args are the command-line arguments as given.
+	Args []string `json:"args"`
+	// Defaults holds the value of every flag that was left unset, so the
+	// run can be reproduced even if a later version changes a default.
+	Defaults map[string]string `json:"defaults"`
+}
+
+// secretFlags are the flags that carry credentials. Their values are never
+// recorded in an invocation.
+var secretFlags = map[string]bool{
+	"password":    true,
+	"turn-pass":   true,
+	"turn-secret": true,
+}
+
+func currentInvocation() *invocation {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	inv := &invocation{Args: redactSecrets(os.Args[1:]), Defaults: make(map[string]string)}
+	flag.VisitAll(func(f *flag.Flag) {
+		// Flags with an empty default are off unless given.
+		if !set[f.Name] && f.DefValue != "" && !secretFlags[f.Name] {
+			inv.Defaults[f.Name] = f.DefValue
+		}
+	})
+	return inv
+}
+
+// redactSecrets returns args with the values of secretFlags replaced, both
+// in the -flag=value and the -flag value forms.
+func redactSecrets(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 0; i < len(redacted); i++ {
+		arg := redacted[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flagPart, _, hasValue := strings.Cut(arg, "=")
+		if !secretFlags[strings.TrimLeft(flagPart, "-")] {
+			continue
+		}
+		if hasValue {
+			redacted[i] = flagPart + "=REDACTED"
+		} else if i+1 < len(redacted) {
+			i++
+			redacted[i] = "REDACTED"
+		}
+	}
+	return redacted
+}
+
+// command renders inv as a command line that can be pasted into a shell.
+// Defaults come first so that positional arguments stay last.
+func (inv *invocation) command() string {
+	names := make([]string, 0, len(inv.Defaults))
+	for name := range inv.Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{"stun-timing"}
+	for _, name := range names {
+		parts = append(parts, shellQuote("-"+name+"="+inv.Defaults[name]))
+	}
+	for _, arg := range inv.Args {
+		parts = append(parts, shellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// showCommand prints the command line that reproduces the run saved in a
+// JSON report.
+func showCommand(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read report: %w", err)
+	}
+	var report struct {
+		Invocation *invocation `json:"invocation"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("failed to parse report: %w", err)
+	}
+	if report.Invocation == nil {
+		return fmt.Errorf("%s does not record the command that produced it", path)
+	}
+	fmt.Println(report.Invocation.command())
+	return nil
+}
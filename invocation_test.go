@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"-host stun.example:3478 -runs 10", "-host stun.example:3478 -runs 10"},
+		{"-user alice -password hunter2", "-user alice -password REDACTED"},
+		{"-password=hunter2 -runs 5", "-password=REDACTED -runs 5"},
+		{"--password hunter2", "--password REDACTED"},
+		{"-turn-pass x -turn-secret=y", "-turn-pass REDACTED -turn-secret=REDACTED"},
+		// Values are redacted after a positional argument too.
+		{"-runs 5 extra -password hunter2", "-runs 5 extra -password REDACTED"},
+		{"-password", "-password"},
+		{"-- -password hunter2", "-- -password hunter2"},
+		{"-passwordx hunter2", "-passwordx hunter2"},
+	}
+	for _, tt := range tests {
+		args := strings.Fields(tt.in)
+		got := strings.Join(redactSecrets(args), " ")
+		if got != tt.want {
+			t.Errorf("redactSecrets(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if strings.Join(args, " ") != tt.in {
+			t.Errorf("redactSecrets(%q) modified its argument", tt.in)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"-runs=10", "-runs=10"},
+		{"stun:stun.example:3478", "stun:stun.example:3478"},
+		{"-label=a b", "'-label=a b'"},
+		{"it's", `'it'\''s'`},
+		{"", "''"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+type jsonPercentile struct {
+	Percentile float64 `json:"percentile"`
+	Time       int64   `json:"time_us"`
+	// CILow and CIHigh bound the 95% bootstrap confidence interval with
+	// -ci.
+	CILow  int64 `json:"ci_low_us,omitempty"`
+	CIHigh int64 `json:"ci_high_us,omitempty"`
+}
+
+type jsonMappedChange struct {
+	Time  time.Time `json:"time"`
+	Index int       `json:"index"`
+	Kind  string    `json:"kind"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+}
+
+type jsonReport struct {
+	Successful  int               `json:"successful"`
+	Failed      int               `json:"failed"`
+	ColdStart   *int64            `json:"cold_start_us,omitempty"`
+	MappedIP    string            `json:"mapped_ip,omitempty"`
+	NAT         string            `json:"nat,omitempty"`
+	Percentiles []jsonPercentile  `json:"percentiles,omitempty"`
+	Histogram   []histogramBucket `json:"histogram,omitempty"`
+
+	// Mean, StdDev and Jitter cover warm requests, like Percentiles.
+	// Jitter is the RFC 3550 interarrival jitter of consecutive RTTs.
+	Mean   int64 `json:"mean_us,omitempty"`
+	StdDev int64 `json:"stddev_us,omitempty"`
+	Jitter int64 `json:"jitter_us,omitempty"`
+
+	// Loss counts timeouts as lost packets; a burst is a run of
+	// consecutive ones.
+	Loss             float64 `json:"loss_pct,omitempty"`
+	LossBursts       int     `json:"loss_bursts,omitempty"`
+	LongestLossBurst int     `json:"longest_loss_burst,omitempty"`
+
+	// MappedChanges lists every change of the mapped address during the
+	// run, e.g. when the ISP rotates the public IP.
+	MappedChanges []jsonMappedChange `json:"mapped_changes,omitempty"`
+
+	// NormalizedTo is the minimum RTT subtracted from every time when
+	// -normalize is set.
+	NormalizedTo int64 `json:"normalized_to_us,omitempty"`
+
+	// InjectedDelay is the artificial per-request delay added by
+	// -inject-delay. Reports carrying it are test runs, not measurements.
+	InjectedDelay int64 `json:"injected_delay_us,omitempty"`
+
+	// Uncorrected and Corrected are the percentiles of an open-loop run
+	// without and with correction for coordinated omission.
+	Uncorrected []jsonPercentile `json:"uncorrected_percentiles,omitempty"`
+	Corrected   []jsonPercentile `json:"corrected_percentiles,omitempty"`
+
+	// Windows is the time series of -bucket-by windows.
+	Windows []jsonWindow `json:"windows,omitempty"`
+
+	// Outliers lists the RTTs flagged by -outliers.
+	Outliers []jsonOutlier `json:"outliers,omitempty"`
+
+	Samples []sampleRecord `json:"samples,omitempty"`
+
+	Invocation *invocation `json:"invocation,omitempty"`
+}
+
+type jsonWindow struct {
+	Start  time.Time `json:"start"`
+	OK     int       `json:"successful"`
+	Failed int       `json:"failed"`
+	Loss   float64   `json:"loss_pct"`
+	P50    int64     `json:"p50_us,omitempty"`
+	P99    int64     `json:"p99_us,omitempty"`
+}
+
+func windowReport(results []result, window time.Duration) []jsonWindow {
+	var report []jsonWindow
+	for _, w := range timeWindows(results, window) {
+		jw := jsonWindow{Start: w.start, OK: len(w.times), Failed: w.failed, Loss: w.loss()}
+		if len(w.times) > 0 {
+			jw.P50, jw.P99 = percentile(w.times, 50), percentile(w.times, 99)
+		}
+		report = append(report, jw)
+	}
+	return report
+}
+
+func buildJSONReport(results []result, percentiles []float64, warmedUp bool) jsonReport {
+	var report jsonReport
+	var successfulTimes, warmTimes []int64
+	cold := coldStartIndex(results, warmedUp)
+	for i, r := range results {
+		if r.err != nil {
+			report.Failed++
+			continue
+		}
+		successfulTimes = append(successfulTimes, r.time)
+		if i == cold {
+			coldStart := r.time
+			report.ColdStart = &coldStart
+		} else {
+			warmTimes = append(warmTimes, r.time)
+		}
+		if report.MappedIP == "" && r.mapped != nil {
+			report.MappedIP = r.mapped.IP.String()
+		}
+	}
+	report.Successful = len(successfulTimes)
+	loss := analyzeLoss(results)
+	report.Loss, report.LossBursts, report.LongestLossBurst = loss.rate(), len(loss.bursts), loss.longestBurst()
+
+	if len(successfulTimes) == 0 {
+		return report
+	}
+	report.NAT = firstNATVerdict(results)
+	for _, e := range detectRebinds(results) {
+		if e.kind != "local address" {
+			report.MappedChanges = append(report.MappedChanges, jsonMappedChange{Time: e.at, Index: e.index, Kind: e.kind, From: e.from, To: e.to})
+		}
+	}
+
+	// Percentiles and the histogram cover warm requests only, matching the
+	// text output.
+	report.Mean = int64(math.Round(mean(warmTimes)))
+	report.StdDev = int64(math.Round(stddev(warmTimes)))
+	report.Jitter = int64(math.Round(jitter(warmTimes)))
+	sort.Slice(warmTimes, func(i, j int) bool { return warmTimes[i] < warmTimes[j] })
+	for _, p := range percentiles {
+		report.Percentiles = append(report.Percentiles, jsonPercentile{Percentile: p, Time: percentile(warmTimes, p)})
+	}
+	report.Histogram = computeHistogram(warmTimes, histogramBuckets)
+
+	return report
+}
+
+func writeJSONReport(cfg config, report any) error {
+	var w io.Writer = os.Stdout
+	if cfg.output != "" {
+		f, err := os.Create(cfg.output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed to write JSON report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Keep-alive requests are spaced like real STUN keep-alive traffic: a random
+// interval between keepaliveMinInterval and keepaliveMaxInterval.
+const (
+	keepaliveMinInterval = 15 * time.Second
+	keepaliveMaxInterval = 25 * time.Second
+)
+
+// keepaliveConfig turns cfg into a keep-alive session lasting about
+// cfg.keepalive: randomized spacing on one socket instead of a tight loop.
+func keepaliveConfig(cfg config) config {
+	cfg.interval = keepaliveMinInterval
+	cfg.intervalJitter = keepaliveMaxInterval - keepaliveMinInterval
+	cfg.runCount = int(cfg.keepalive/((keepaliveMinInterval+keepaliveMaxInterval)/2)) + 1
+	fmt.Fprintf(cfg.logOutput(), "Keep-alive session: ~%d requests over %s, %s-%s apart\n",
+		cfg.runCount, cfg.keepalive, keepaliveMinInterval, keepaliveMaxInterval)
+	return cfg
+}
+
+// pause returns how long to wait before the next request: cfg.interval plus
+// up to cfg.intervalJitter.
+func (cfg config) pause() time.Duration {
+	if cfg.intervalJitter <= 0 {
+		return cfg.interval
+	}
+	return cfg.interval + time.Duration(rand.Int63n(int64(cfg.intervalJitter)+1))
+}
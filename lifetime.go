@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// Binding lifetime discovery doubles the idle time from lifetimeFirstIdle
+// until a binding expires, then bisects until the lifetime is known to
+// within lifetimeResolution.
+const (
+	lifetimeFirstIdle  = 5 * time.Second
+	lifetimeResolution = 5 * time.Second
+)
+
+// keepaliveMargin is the share of the shortest idle time a binding
+// survived that the recommended keepalive interval uses, leaving room for
+// lost keepalives and NATs that time out a little early under load.
+const keepaliveMargin = 2.0 / 3
+
+func responsePort(port int) stun.RawAttribute {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint16(v, uint16(port))
+	return stun.RawAttribute{Type: stun.AttrResponsePort, Value: v}
+}
+
+// bindingLifetime bounds how long the NAT keeps an idle UDP binding: one
+// idle for alive was still open, one idle for expired was not. expired is
+// zero if no binding expired within the longest idle time tried.
+type bindingLifetime struct {
+	alive, expired time.Duration
+	noNAT          bool
+}
+
+func (l bindingLifetime) String() string {
+	switch {
+	case l.noNAT:
+		return "unlimited (no NAT)"
+	case l.expired == 0:
+		return fmt.Sprintf("at least %s", l.alive)
+	default:
+		return fmt.Sprintf("between %s and %s", l.alive, l.expired)
+	}
+}
+
+// recommendedKeepalive returns the keepalive interval that keeps bindings
+// alive with a safety margin. It reports false when no binding survived even
+// the shortest idle time tried, so there is nothing to base it on.
+func (l bindingLifetime) recommendedKeepalive() (time.Duration, bool) {
+	if l.alive == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(l.alive) * keepaliveMargin).Truncate(time.Second), true
+}
+
+// bindingAlive opens a binding on a fresh socket, leaves it idle for idle
+// and then, from a second socket, asks the server to answer to the first
+// socket's mapped port with RESPONSE-PORT (RFC 5780, section 4.6). It
+// reports whether that answer still got through.
+func bindingAlive(cfg config, server *net.UDPAddr, idle time.Duration) (bool, bool, error) {
+	x, err := listenNAT(cfg)
+	if err != nil {
+		return false, false, err
+	}
+	defer x.Close()
+
+	t := &natTest{name: "Binding", to: server}
+	x.run(t)
+	if t.err != nil {
+		return false, false, fmt.Errorf("failed to open binding: %w", t.err)
+	}
+	_, port := addrIPPort(x.conn.LocalAddr())
+	if sameAddr(t.mapped, &net.UDPAddr{IP: currentLocalIP(x.d, server), Port: port}) {
+		return true, true, nil
+	}
+
+	time.Sleep(idle)
+
+	y, err := listenNAT(cfg)
+	if err != nil {
+		return false, false, err
+	}
+	defer y.Close()
+
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest, responsePort(t.mapped.Port), stun.Fingerprint)
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < natAttempts; attempt++ {
+		start := time.Now()
+		if _, err := y.conn.WriteTo(req.Raw, server); err != nil {
+			return false, false, err
+		}
+		x.conn.SetReadDeadline(start.Add(x.timeout / natAttempts))
+		for {
+			n, _, err := x.conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			m := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if m.Decode() == nil && m.TransactionID == req.TransactionID {
+				return true, false, nil
+			}
+		}
+	}
+	return false, false, nil
+}
+
+// discoverBindingLifetime measures how long the NAT keeps idle UDP bindings,
+// trying idle times up to longest.
+func discoverBindingLifetime(cfg config, server *net.UDPAddr, longest time.Duration) (bindingLifetime, error) {
+	var l bindingLifetime
+
+	// Without any idle time the answer has to get through; if it does not,
+	// the server ignores RESPONSE-PORT.
+	alive, noNAT, err := bindingAlive(cfg, server, 0)
+	switch {
+	case err != nil:
+		return l, err
+	case noNAT:
+		l.noNAT = true
+		return l, nil
+	case !alive:
+		return l, errors.New("no response through RESPONSE-PORT; the server has to support RFC 5780")
+	}
+
+	try := func(idle time.Duration) (bool, error) {
+		fmt.Printf("Idle %-8s ", idle)
+		alive, _, err := bindingAlive(cfg, server, idle)
+		if err != nil {
+			fmt.Println()
+			return false, err
+		}
+		if alive {
+			fmt.Println("alive")
+		} else {
+			fmt.Println("expired")
+		}
+		return alive, nil
+	}
+
+	for idle := lifetimeFirstIdle; ; idle *= 2 {
+		idle = min(idle, longest)
+		alive, err := try(idle)
+		if err != nil {
+			return l, err
+		}
+		if !alive {
+			l.expired = idle
+			break
+		}
+		l.alive = idle
+		if idle == longest {
+			return l, nil
+		}
+	}
+
+	for l.expired-l.alive > lifetimeResolution {
+		idle := (l.alive + l.expired) / 2
+		alive, err := try(idle)
+		if err != nil {
+			return l, err
+		}
+		if alive {
+			l.alive = idle
+		} else {
+			l.expired = idle
+		}
+	}
+	return l, nil
+}
+
+// runBindingLifetime reports how long the NAT keeps an idle UDP binding
+// open.
+func runBindingLifetime(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-binding-lifetime needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Binding lifetime discovery via %s, idle up to %s\n\n", server, cfg.bindingLifetime)
+	l, err := discoverBindingLifetime(cfg, server, cfg.bindingLifetime)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nBinding lifetime: %s\n", l)
+	if l.noNAT {
+		fmt.Println("Recommended keepalive interval: none needed for NAT bindings")
+		return nil
+	}
+	interval, ok := l.recommendedKeepalive()
+	if !ok {
+		fmt.Printf("Recommended keepalive interval: unknown, bindings expire within %s\n", l.expired)
+		return nil
+	}
+	fmt.Printf("Recommended keepalive interval: %s\n", interval)
+
+	if cfg.verifyKeepalive > 0 {
+		return verifyKeepalive(cfg, interval)
+	}
+	return nil
+}
+
+// verifyKeepalive sends Binding requests on one socket every interval for
+// cfg.verifyKeepalive and checks that the mapped address stays the same,
+// which it would not if the binding expired in between.
+func verifyKeepalive(cfg config, interval time.Duration) error {
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	verifyCfg := cfg
+	verifyCfg.interval = interval
+	verifyCfg.intervalJitter = 0
+	verifyCfg.runCount = int(cfg.verifyKeepalive/interval) + 1
+	verifyCfg.duration = 0
+	fmt.Printf("\nVerifying: %d requests %s apart on one socket\n", verifyCfg.runCount, interval)
+	results, err := p.run(verifyCfg)
+	if err != nil {
+		return err
+	}
+
+	failed, changes := 0, 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+	}
+	for _, e := range detectRebinds(results) {
+		if e.kind != "local address" {
+			changes++
+			fmt.Printf("  request #%d: %s changed %s -> %s\n", e.index, e.kind, e.from, e.to)
+		}
+	}
+	switch {
+	case changes > 0:
+		fmt.Printf("Verification failed: the mapped address changed %d times at a %s interval\n", changes, interval)
+	case failed == len(results):
+		fmt.Println("Verification failed: no successful responses")
+	default:
+		fmt.Printf("Verified: the mapped address stayed the same over %d requests (%d failed)\n", len(results), failed)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pion/stun"
+)
+
+// lossStats describes which requests in a run timed out. A burst is a run of
+// consecutive timeouts and a gap the run of answered requests between two
+// bursts.
+type lossStats struct {
+	sent   int
+	lost   int
+	bursts []int
+	gaps   []int
+	// afterLoss counts the requests sent right after a timeout, and
+	// lostAfterLoss how many of those timed out too.
+	afterLoss     int
+	lostAfterLoss int
+}
+
+// analyzeLoss treats timeouts in results, in the order they were sent, as
+// lost packets. Requests that failed in other ways were answered, so they
+// count neither as losses nor as gaps.
+func analyzeLoss(results []result) lossStats {
+	s := lossStats{sent: len(results)}
+	burst, gap := 0, -1
+	prevLost := false
+	for _, r := range results {
+		lost := errors.Is(r.err, stun.ErrTransactionTimeOut)
+		if prevLost {
+			s.afterLoss++
+			if lost {
+				s.lostAfterLoss++
+			}
+		}
+		prevLost = lost
+		if lost {
+			s.lost++
+			if burst == 0 && gap >= 0 {
+				s.gaps = append(s.gaps, gap)
+			}
+			burst++
+			continue
+		}
+		if r.err != nil {
+			continue
+		}
+		if burst > 0 {
+			s.bursts = append(s.bursts, burst)
+			burst, gap = 0, 0
+		}
+		if gap >= 0 {
+			gap++
+		}
+	}
+	if burst > 0 {
+		s.bursts = append(s.bursts, burst)
+	}
+	return s
+}
+
+func (s lossStats) rate() float64 {
+	return float64(s.lost) / float64(max(s.sent, 1)) * 100
+}
+
+func (s lossStats) longestBurst() int {
+	longest := 0
+	for _, b := range s.bursts {
+		longest = max(longest, b)
+	}
+	return longest
+}
+
+// printLoss reports the loss rate and how the losses cluster, but only when
+// at least one request timed out. Media codecs conceal isolated losses far
+// better than bursts, so the same loss rate can sound very different.
+func printLoss(results []result) {
+	s := analyzeLoss(results)
+	if s.lost == 0 {
+		return
+	}
+
+	fmt.Printf("\nPacket loss: %d of %d requests timed out (%.2f%%)\n", s.lost, s.sent, s.rate())
+	fmt.Printf("Loss bursts: %d, longest %d in a row, mean %.1f\n",
+		len(s.bursts), s.longestBurst(), float64(s.lost)/float64(len(s.bursts)))
+
+	lengths := make(map[int]int)
+	for _, b := range s.bursts {
+		lengths[b]++
+	}
+	keys := make([]int, 0, len(lengths))
+	for k := range lengths {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%d x%d", k, lengths[k]))
+	}
+	fmt.Printf("Burst lengths: %s\n", strings.Join(parts, ", "))
+
+	if s.afterLoss > 0 && s.lost < s.sent {
+		conditional := float64(s.lostAfterLoss) / float64(s.afterLoss) * 100
+		// With independent losses a loss after a loss is no likelier than
+		// any other.
+		verdict := "random"
+		if conditional > 2*s.rate() {
+			verdict = "bursty"
+		}
+		fmt.Printf("Loss right after a loss: %.1f%% vs %.2f%% overall (%s)\n", conditional, s.rate(), verdict)
+	}
+
+	if len(s.gaps) > 0 {
+		gaps := make([]int64, len(s.gaps))
+		for i, g := range s.gaps {
+			gaps[i] = int64(g)
+		}
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		fmt.Printf("Answered requests between bursts: min %d, p50 %d, p90 %d, max %d\n",
+			gaps[0], percentile(gaps, 50), percentile(gaps, 90), gaps[len(gaps)-1])
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/pion/stun"
+)
+
+// lossResults turns a pattern into results: '.' is answered, 'x' timed out
+// and 'e' failed some other way.
+func lossResults(pattern string) []result {
+	results := make([]result, len(pattern))
+	for i, c := range pattern {
+		switch c {
+		case 'x':
+			results[i].err = stun.ErrTransactionTimeOut
+		case 'e':
+			results[i].err = errors.New("Binding failed: 500 Server Error")
+		default:
+			results[i].time = 1000
+		}
+	}
+	return results
+}
+
+func TestAnalyzeLoss(t *testing.T) {
+	tests := []struct {
+		pattern                  string
+		lost                     int
+		bursts, gaps             []int
+		afterLoss, lostAfterLoss int
+		longest                  int
+	}{
+		{"....", 0, nil, nil, 0, 0, 0},
+		{"..xx...x..", 3, []int{2, 1}, []int{3}, 3, 1, 2},
+		{"x.e.x", 2, []int{1, 1}, []int{2}, 1, 0, 1},
+		{"xex", 2, []int{2}, nil, 1, 0, 2},
+		{"xxx", 3, []int{3}, nil, 2, 2, 3},
+		{"eee", 0, nil, nil, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		s := analyzeLoss(lossResults(tt.pattern))
+		if s.sent != len(tt.pattern) || s.lost != tt.lost {
+			t.Errorf("%s: lost %d of %d, want %d of %d", tt.pattern, s.lost, s.sent, tt.lost, len(tt.pattern))
+		}
+		if !slices.Equal(s.bursts, tt.bursts) || !slices.Equal(s.gaps, tt.gaps) {
+			t.Errorf("%s: bursts %v, gaps %v, want %v, %v", tt.pattern, s.bursts, s.gaps, tt.bursts, tt.gaps)
+		}
+		if s.afterLoss != tt.afterLoss || s.lostAfterLoss != tt.lostAfterLoss {
+			t.Errorf("%s: %d of %d lost after a loss, want %d of %d", tt.pattern, s.lostAfterLoss, s.afterLoss, tt.lostAfterLoss, tt.afterLoss)
+		}
+		if got := s.longestBurst(); got != tt.longest {
+			t.Errorf("%s: longestBurst() = %d, want %d", tt.pattern, got, tt.longest)
+		}
+	}
+}
@@ -1,160 +1,1812 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/pion/dtls/v2"
 	"github.com/pion/stun"
 	"github.com/schollz/progressbar/v3"
 )
 
 type config struct {
-	stunHost string
-	runCount int
-	timeout  time.Duration
+	stunHost   string
+	runCount   int
+	warmup     int
+	duration   time.Duration
+	digestRTTs bool
+	timeout    time.Duration
+	bucketBy   time.Duration
+	maxRTTDrop time.Duration
+	iface      string
+	ipVersion  int
+	altSize    int
+	format     string
+	output     string
+	decode     string
+	verbose    bool
+	required   attrList
+	showCV     bool
+	showCI     bool
+	otherAddr  bool
+
+	adaptive       bool
+	adaptiveEvery  int
+	adaptiveTarget float64
+	rebindAfter    int
+	reorder        bool
+	rate           float64
+	ramp           *rampProfile
+	maxInflight    int
+	sendInterval   time.Duration
+
+	// adaptivePercentiles are the percentiles whose CIs must be narrow
+	// enough for an adaptive run to stop.
+	adaptivePercentiles []float64
+
+	checkTruncation bool
+	strict          bool
+	maxRedirects    int
+
+	// interval is the pause between consecutive requests. Scenarios set it
+	// per step.
+	interval time.Duration
+
+	scenario   string
+	normalize  bool
+	vpnCompare string
+	abCompare  string
+	eachIP     bool
+	dualStack  bool
+	transports string
+	htmlPath   string
+
+	rampConcurrency int
+	concurrency     int
+	reconnect       bool
+	resolveEach     bool
+	coldCompare     bool
+	throughput      bool
+	bufferbloat     bool
+	loadTarget      string
+	loadRate        float64
+	portStudy       bool
+	portSockets     int
+	serve           string
+	monitor         bool
+	summaryEvery    time.Duration
+	alertCommand    string
+	targetsFile     string
+	discover        bool
+	discoverURL     string
+	scoreWeights    scoreWeights
+	rankingFile     string
+	histCap         int
+	baseline        bool
+	fields          []sampleField
+	blackholeTest   bool
+	natCheck        bool
+	serverCaps      bool
+	natMapping      bool
+	natFiltering    bool
+	hairpin         bool
+	bindingLifetime time.Duration
+	verifyKeepalive time.Duration
+	messagesFile    string
+	explainBucket   int
+	outliers        bool
+	trimOutliers    bool
+	injectDelay     time.Duration
+	stream          bool
+
+	keepalive   time.Duration
+	showCommand string
+	csvPath     string
+
+	statsdAddr   string
+	statsdPrefix string
+	statsdTags   []string
+
+	otlpEndpoint string
+	hgrmPath     string
+	transport    string
+
+	turn        bool
+	turnUser    string
+	turnPass    string
+	turnSecret  string
+	turnTTL     time.Duration
+	turnRESTURL string
+
+	user     string
+	password string
+	realm    string
+
+	tlsInsecure   bool
+	tlsServerName string
+	tlsCA         string
+
+	influxURL         string
+	influxMeasurement string
+	influxTags        [][2]string
+
+	sla     slaThresholds
+	noColor bool
+
+	checkpointPath     string
+	checkpointInterval time.Duration
+	resume             bool
+
+	tablePercentiles  []float64
+	exportPercentiles []float64
+
+	// padding adds a PADDING attribute of this many bytes to every request.
+	padding int
+
+	// quiet suppresses progress output, for runs that happen in parallel.
+	quiet bool
+	// intervalJitter adds a random extra pause of up to this much to
+	// interval.
+	intervalJitter time.Duration
+	// statsd, when set, is sent every response's metrics.
+	statsd *statsdClient
+	// ndjson receives the samples of -format ndjson: the -output file, or
+	// stdout.
+	ndjson io.Writer
+	// hookOutput, when set, is where the verbose and stream hooks print
+	// instead of logOutput, so that quiet workers still report them.
+	hookOutput io.Writer
+	// hookMu, when set, is held while a request's hooks run, so that
+	// workers sharing the hooks' writers take turns.
+	hookMu *sync.Mutex
+	// checkpoint, when set, receives every result as it is collected.
+	checkpoint *checkpointer
+	// digest, when set, takes every result in place of the slice a run
+	// returns, so that a run of any length takes bounded memory.
+	digest *digestRun
+	// auth, when set, authenticates Binding requests and keeps the realm
+	// and nonce the server last handed out. -concurrency gives each worker
+	// its own copy.
+	auth *longTermCredentials
 }
 
 type result struct {
-	time int64
-	err  error
+	index  int
+	start  time.Time
+	time   int64
+	err    error
+	local  net.IP
+	port   int
+	mapped *net.UDPAddr
+	other  *net.UDPAddr
+	size   int
+	txid   [stun.TransactionIDSize]byte
+
+	// sendBlock is how long sending the request took. It is part of time,
+	// but a large value points at local backpressure rather than the network.
+	sendBlock time.Duration
+	// connect is how long setting up the TCP connection took, on the first
+	// request sent over each connection.
+	connect time.Duration
+	// handshake is the TLS or DTLS handshake time, recorded alongside
+	// connect.
+	handshake time.Duration
+	// challenge is the unauthenticated round trip that fetched the nonce
+	// for this request, if one was needed.
+	challenge time.Duration
+	// lookup is the DNS lookup time of the socket with -resolve-each,
+	// recorded alongside connect.
+	lookup time.Duration
+	// sendLag is how long after it was due an open-loop request was sent.
+	// It is part of time.
+	sendLag time.Duration
+	// rebound is set on the first request after -rebind-after replaced the
+	// socket, whose new mapping the tool caused itself.
+	rebound bool
+
+	// arrival is the order in which the response was received, with -1
+	// meaning no response. Only the async engine sets it.
+	arrival int
+}
+
+func main() {
+	cfg := parseFlags()
+
+	if cfg.showCommand != "" {
+		if err := showCommand(cfg.showCommand); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.decode != "" {
+		results, err := readBinaryResults(cfg.decode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printDecodedResults(results)
+		printResults(cfg, results)
+		printASCIIHistogram(cfg, results)
+		return
+	}
+
+	if cfg.adaptive && cfg.adaptiveEvery < 1 {
+		fmt.Fprintln(os.Stderr, "Error: -adaptive-every must be at least 1")
+		os.Exit(1)
+	}
+
+	switch cfg.format {
+	case "text", "json", "ndjson", "influx", "markdown":
+	case "binary":
+		if cfg.output == "" {
+			fmt.Fprintln(os.Stderr, "Error: -format binary requires -output")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q\n", cfg.format)
+		os.Exit(1)
+	}
+
+	if rest, ok := strings.CutPrefix(cfg.stunHost, "stuns:"); ok {
+		cfg.stunHost, cfg.transport = rest, "tls"
+	}
+	if strings.HasPrefix(cfg.stunHost, "turn:") || strings.HasPrefix(cfg.stunHost, "turns:") {
+		host, transport, err := parseTURNURI(cfg.stunHost)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.stunHost, cfg.transport, cfg.turn = host, transport, true
+	}
+
+	switch cfg.transport {
+	case "udp":
+	case "tcp", "tls", "dtls":
+		if cfg.reorder || cfg.rate > 0 || cfg.ramp != nil || cfg.maxInflight > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -reorder, -rate, -ramp and -max-inflight need -transport udp")
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown transport %q\n", cfg.transport)
+		os.Exit(1)
+	}
+
+	if cfg.statsdAddr != "" {
+		c, err := dialStatsd(cfg.statsdAddr, cfg.statsdPrefix, cfg.statsdTags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.statsd = c
+	}
+
+	if cfg.format == "ndjson" {
+		cfg.ndjson = os.Stdout
+		if cfg.output != "" {
+			f, err := os.Create(cfg.output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to create output file: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			cfg.ndjson = f
+		}
+	}
+
+	auth, err := bindingCredentials(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.auth = auth
+
+	if cfg.targetsFile != "" {
+		if err := runTargets(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.discover {
+		if err := runDiscover(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.turn {
+		if err := runTURN(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.scenario != "" {
+		if err := runScenario(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.serve != "" {
+		if err := runServe(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.monitor {
+		if err := runMonitor(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.rampConcurrency > 0 {
+		if err := runConcurrencyRamp(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.messagesFile != "" {
+		if err := runMessagesFile(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.serverCaps {
+		if err := runCapabilities(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.natCheck {
+		if err := runNATCheck(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.natMapping {
+		if err := runNATMapping(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.natFiltering {
+		if err := runNATFiltering(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.hairpin {
+		if err := runHairpin(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.bindingLifetime > 0 {
+		if err := runBindingLifetime(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.portSockets > 0 {
+		if err := runPortSockets(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.blackholeTest {
+		if err := runBlackholeTest(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.bufferbloat {
+		if err := runBufferbloat(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.throughput {
+		if err := runThroughput(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.coldCompare {
+		if err := runColdCompare(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.transports != "" {
+		if err := runTransportComparison(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.dualStack {
+		if err := runDualStack(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.eachIP {
+		if err := runEachIP(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.abCompare != "" {
+		if err := runABCompare(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.vpnCompare != "" {
+		if err := runVPNComparison(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if strings.Contains(cfg.stunHost, ",") {
+		if err := runMultiHost(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Open-loop and pipelined runs are -reorder runs on a fixed timeline or
+	// with bounded outstanding requests.
+	if cfg.rate > 0 || cfg.ramp != nil || cfg.maxInflight > 0 {
+		cfg.reorder = true
+	}
+	if cfg.ramp != nil {
+		cfg.runCount = cfg.ramp.total()
+	}
+
+	if cfg.warmup > 0 && cfg.reorder {
+		fmt.Fprintln(os.Stderr, "Error: -warmup cannot be combined with -reorder")
+		os.Exit(1)
+	}
+
+	if cfg.injectDelay > 0 && cfg.reorder {
+		fmt.Fprintln(os.Stderr, "Error: -inject-delay cannot be combined with -reorder")
+		os.Exit(1)
+	}
+
+	if cfg.digestRTTs && (cfg.reorder || cfg.concurrency > 1 || cfg.adaptive || cfg.checkpointPath != "" ||
+		(cfg.format != "text" && cfg.format != "ndjson") || cfg.csvPath != "" || cfg.hgrmPath != "" ||
+		cfg.htmlPath != "" || cfg.otlpEndpoint != "" || cfg.influxURL != "") {
+		fmt.Fprintln(os.Stderr, "Error: -digest keeps no samples, so it only supports the text summary and -format ndjson, and cannot be combined with -reorder, -concurrency, -adaptive, -checkpoint, -csv, -hgrm, -html, -otlp or -influx-url")
+		os.Exit(1)
+	}
+
+	// Requests sent without waiting cannot stop for a nonce round trip.
+	if cfg.auth != nil && cfg.reorder {
+		fmt.Fprintln(os.Stderr, "Error: -user cannot be combined with -reorder, -rate, -ramp or -max-inflight")
+		os.Exit(1)
+	}
+
+	if cfg.concurrency > 1 && (cfg.reorder || cfg.checkpointPath != "") {
+		fmt.Fprintln(os.Stderr, "Error: -concurrency cannot be combined with -reorder, -checkpoint or -resume")
+		os.Exit(1)
+	}
+
+	if cfg.duration > 0 && (cfg.reorder || cfg.keepalive > 0) {
+		fmt.Fprintln(os.Stderr, "Error: -duration cannot be combined with -reorder or -keepalive")
+		os.Exit(1)
+	}
+
+	if cfg.keepalive > 0 {
+		if cfg.reorder {
+			fmt.Fprintln(os.Stderr, "Error: -keepalive cannot be combined with -reorder")
+			os.Exit(1)
+		}
+		cfg = keepaliveConfig(cfg)
+	}
+
+	var resumed []result
+	if cfg.checkpointPath != "" {
+		if cfg.reorder {
+			fmt.Fprintln(os.Stderr, "Error: -checkpoint and -resume cannot be combined with -reorder")
+			os.Exit(1)
+		}
+		cp, prev, err := openCheckpoint(cfg.checkpointPath, cfg.checkpointInterval, cfg.resume)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if cfg.resume {
+			fmt.Fprintf(cfg.logOutput(), "Resumed %d samples from %s\n", len(prev), cfg.checkpointPath)
+		}
+		resumed = prev
+		// -duration bounds the run by time, so the resumed samples do not
+		// count against it.
+		if cfg.duration == 0 {
+			cfg.runCount = max(cfg.runCount-len(resumed), 0)
+		}
+		cfg.checkpoint = cp
+	}
+
+	if cfg.digestRTTs {
+		cfg.digest = &digestRun{warmedUp: cfg.warmup > 0}
+	}
+
+	run := runSTUNRequests
+	switch {
+	case cfg.reorder:
+		run = runAsyncRequests
+	case cfg.concurrency > 1:
+		run = runWorkers
+	}
+
+	var results []result
+	if cfg.runCount > 0 || cfg.duration > 0 {
+		var err error
+		if results, err = run(cfg, cfg.stunHost); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.digest != nil {
+		// ndjson samples were written as they completed.
+		if cfg.format == "text" {
+			cfg.digest.print(cfg)
+		}
+		return
+	}
+	if cfg.checkpoint != nil {
+		if err := cfg.checkpoint.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		for i := range results {
+			results[i].index += len(resumed)
+		}
+		results = append(resumed, results...)
+	}
+
+	if cfg.format == "binary" {
+		if err := writeBinaryResults(cfg.output, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.maxRTTDrop > 0 {
+		var dropped int
+		results, dropped = dropImplausible(results, cfg.maxRTTDrop)
+		fmt.Fprintf(cfg.logOutput(), "Dropped %d implausibly fast samples (< %s)\n", dropped, cfg.maxRTTDrop)
+	}
+
+	if cfg.csvPath != "" {
+		fields := cfg.fields
+		if len(fields) == 0 {
+			fields, _ = parseFields(strings.Join(defaultCSVFields, ","))
+		}
+		if err := writeCSV(cfg.csvPath, fields, cfg.stunHost, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.hgrmPath != "" {
+		if err := writeHgrm(cfg.hgrmPath, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.htmlPath != "" {
+		if err := writeHTMLReport(cfg.htmlPath, cfg, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.otlpEndpoint != "" {
+		if err := exportOTLP(cfg, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.format == "influx" || cfg.influxURL != "" {
+		if err := writeInflux(cfg, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Exports above keep absolute RTTs; only the reports below are relative.
+	var normalizedTo int64
+	if cfg.normalize {
+		normalizedTo = normalizeResults(results)
+		fmt.Fprintf(cfg.logOutput(), "Minimum RTT: %d μs (results below are relative to it)\n", normalizedTo)
+	}
+
+	// ndjson samples were written as they completed and Influx lines just
+	// above, so there is no report left to print.
+	if cfg.format == "ndjson" || cfg.format == "influx" {
+		return
+	}
+
+	if cfg.format == "markdown" {
+		printMarkdownReport(cfg, results)
+		return
+	}
+
+	if cfg.format == "json" {
+		report := buildJSONReport(results, cfg.exportPercentiles, cfg.warmup > 0)
+		report.NormalizedTo = normalizedTo
+		report.InjectedDelay = cfg.injectDelay.Microseconds()
+		if cfg.showCI {
+			addBootstrapCIs(report.Percentiles, results, cfg.warmup > 0)
+		}
+		if cfg.outliers {
+			report.Outliers = outlierReport(results)
+		}
+		if correctsOmission(cfg) {
+			report.Uncorrected, report.Corrected = omissionReport(results, cfg.exportPercentiles)
+		}
+		report.Invocation = currentInvocation()
+		if cfg.bucketBy > 0 {
+			report.Windows = windowReport(results, cfg.bucketBy)
+		}
+		if len(cfg.fields) > 0 {
+			for _, r := range results {
+				report.Samples = append(report.Samples, newSampleRecord(cfg.fields, cfg.stunHost, r))
+			}
+		}
+		if err := writeJSONReport(cfg, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	printResults(cfg, results)
+	if cfg.adaptive {
+		printAdaptiveSummary(cfg, results)
+	}
+	// Every fresh socket gets a new mapping, so rebinds are expected noise.
+	if !cfg.reconnect && cfg.concurrency <= 1 {
+		printRebinds(results)
+	}
+	if cfg.reorder {
+		printReordering(results)
+	}
+	if cfg.ramp != nil {
+		printRamp(results, cfg.ramp)
+	}
+	if correctsOmission(cfg) {
+		printOmission(results)
+	}
+	if cfg.checkTruncation {
+		printTruncation(results)
+	}
+	if cfg.strict {
+		printInvalid(results)
+	}
+	printLoss(results)
+	printSendBlocking(results)
+	printConnectSetup(results, cfg.transport)
+	printChallenges(results)
+	if cfg.portStudy {
+		printPortDistribution(results)
+	}
+	if cfg.rebindAfter > 0 {
+		printRebindAfter(results, cfg.rebindAfter)
+	}
+	printASCIIHistogram(cfg, results)
+	if cfg.explainBucket > 0 {
+		printBucketSamples(cfg, results, cfg.explainBucket)
+	}
+	if cfg.outliers {
+		printOutliers(results, cfg.trimOutliers)
+	}
+
+	if cfg.altSize > 0 {
+		printSizeComparison(results)
+	}
+
+	if cfg.bucketBy > 0 {
+		printTimeWindows(results, cfg.bucketBy)
+	}
+
+	if cfg.baseline {
+		if err := runBaseline(cfg, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg.otherAddr {
+		if err := measureOtherAddress(cfg, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func parseFlags() config {
+	targetsFile := flag.String("targets", "", "Measure every STUN/TURN URI in this file, one per line with an optional label after it, and report them together")
+	discover := flag.Bool("discover", false, "Probe a built-in list of well-known public STUN servers and rank them (10 requests each unless -runs is set)")
+	discoverURL := flag.String("discover-url", "", "With -discover, fetch the server list from this URL instead, in the -targets file format; implies -discover")
+	weights := defaultScoreWeights
+	flag.Func("score", "Weights for ranking servers by p99 latency, loss and jitter, e.g. latency=0.5,loss=0.4,jitter=0.1 (default latency=0.5,loss=0.3,jitter=0.2)", func(s string) error {
+		var err error
+		weights, err = parseScoreWeights(s)
+		return err
+	})
+	var hosts []string
+	flag.Func("host", "STUN server hostname (default stun.cloudflare.com:3478); repeat the flag or give a comma-separated list to compare several", func(s string) error {
+		hosts = append(hosts, s)
+		return nil
+	})
+	runCount := flag.Int("runs", 1, "Number of times to run the STUN request")
+	warmup := flag.Int("warmup", 0, "Send this many requests on the socket first and leave them out of the statistics, so first-packet effects do not skew small runs")
+	duration := flag.Duration("duration", 0, "Keep sending requests until this much time has passed (e.g. 10m) instead of a fixed -runs count")
+	digest := flag.Bool("digest", false, "Summarize RTTs in a bounded-memory digest instead of keeping every sample, for multi-hour or multi-million-request runs; percentiles are estimated within 1%")
+	timeout := flag.Duration("timeout", 5*time.Second, "Timeout for each STUN request, including its retransmissions over UDP")
+	bucketBy := flag.Duration("bucket-by", 0, "Group results into wall-clock windows of this size (e.g. 1m)")
+	maxRTTDrop := flag.Duration("max-rtt-drop", 0, "Drop samples faster than this as implausible (e.g. 200us)")
+	iface := flag.String("interface", "", "Bind to this network interface with SO_BINDTODEVICE (Linux only)")
+	ipv4Only := flag.Bool("4", false, "Resolve and dial the server over IPv4 only")
+	ipv6Only := flag.Bool("6", false, "Resolve and dial the server over IPv6 only")
+	altSize := flag.Int("alternate-size", 0, "Pad every other request with this many bytes to compare small vs large packets")
+	format := flag.String("format", "text", "Output format: text, json, ndjson (one object per request as it completes), influx (line protocol), markdown or binary")
+	output := flag.String("output", "", "File to write results to (required for -format binary, defaults to stdout for json and ndjson)")
+	decode := flag.String("decode", "", "Decode a binary results file, print its records and summary, then exit")
+	verbose := flag.Bool("verbose", false, "Log the transaction ID and RTT of every request")
+	var required attrList
+	flag.Var(&required, "require-attr", "Count responses lacking this STUN attribute as incomplete (repeatable)")
+	showCV := flag.Bool("cv", false, "Also show the coefficient of variation")
+	showCI := flag.Bool("ci", false, "Also show 95% bootstrap confidence intervals for the percentiles")
+	otherAddr := flag.Bool("other-address", false, "Also measure the server's OTHER-ADDRESS/CHANGED-ADDRESS")
+	adaptive := flag.Bool("adaptive", false, "Stop early once the median's 95% CI is narrow enough (-runs becomes the cap)")
+	adaptiveEvery := flag.Int("adaptive-every", 20, "Check convergence every this many samples in -adaptive mode")
+	adaptiveTarget := flag.Float64("adaptive-target", 0.05, "CI width, as a fraction of the estimate, at which -adaptive and -auto stop")
+	auto := flag.Bool("auto", false, "Keep sampling until the p50 and p99 95% CIs are within -adaptive-target, up to 100000 requests unless -runs is set")
+	rebindAfter := flag.Int("rebind-after", 0, "Close and reopen the socket on a new local port after this many requests")
+	reorder := flag.Bool("reorder", false, "Send without waiting for responses and report out-of-order responses")
+	sendInterval := flag.Duration("send-interval", time.Millisecond, "Delay between sends in -reorder mode")
+	throughput := flag.Bool("throughput", false, "Find the highest Binding request rate the server sustains, doubling an open-loop rate and then bisecting, and report latency and failures at that rate")
+	bufferbloat := flag.Bool("bufferbloat", false, "Compare STUN latency on an idle link with latency while -load-target receives background UDP traffic, and grade the difference")
+	loadTarget := flag.String("load-target", "", "UDP sink or echo service (host:port) that -bufferbloat sends background traffic to; an echo service loads both directions")
+	loadRate := 10e6
+	flag.Func("load-rate", "Bit rate of the -bufferbloat background traffic (default 10M)", func(s string) error {
+		var err error
+		loadRate, err = parseBitrate(s)
+		return err
+	})
+	var ramp *rampProfile
+	flag.Func("ramp", "Send requests open-loop at a rate rising linearly from:to:duration (e.g. 10:1000:60s) and report where latency or loss degrades; implies -reorder and replaces -runs", func(s string) error {
+		var err error
+		ramp, err = parseRamp(s)
+		return err
+	})
+	maxInflight := flag.Int("max-inflight", 0, "Pipeline requests on one socket with at most this many awaiting a response, matched by transaction ID; implies -reorder")
+	var rate float64
+	flag.Func("rate", "Send requests open-loop at this fixed rate (e.g. 100/s), timing each from when it was due so server slowdowns are not hidden; implies -reorder", func(s string) error {
+		var err error
+		rate, err = parseRate(s)
+		return err
+	})
+	checkTruncation := flag.Bool("check-truncation", false, "Inspect raw responses and report truncated or malformed ones separately")
+	maxRedirects := flag.Int("max-redirects", defaultMaxRedirects, "Follow up to this many 300 Try Alternate responses to the server they name (0 to treat them as failures)")
+	strict := flag.Bool("strict", false, "Send FINGERPRINT with every request, require a valid FINGERPRINT and known transaction ID on responses, and count invalid responses separately from timeouts")
+	scenario := flag.String("scenario", "", "Run the ordered measurement steps described in this JSON file")
+	normalize := flag.Bool("normalize", false, "Report percentiles and histogram as time above the minimum RTT")
+	vpnCompare := flag.String("vpn-compare", "", "Measure through two interfaces, vpn,bare, and report the VPN's overhead")
+	transports := flag.String("transports", "", "Measure the host over each of these transports, e.g. udp,tcp,tls:5349, and compare setup cost and RTT")
+	dualStack := flag.Bool("dual-stack", false, "Measure the host over both IPv4 and IPv6 and report which family to prefer")
+	eachIP := flag.Bool("each-ip", false, "Measure every address the host resolves to and break the results out per IP")
+	abCompare := flag.String("compare", "", "Measure two targets, a,b, with interleaved requests and test whether their RTTs differ significantly; each is host or host/transport")
+	htmlPath := flag.String("html", "", "Also write a self-contained HTML report to this file")
+	flag.StringVar(htmlPath, "report", "", "Same as -html")
+	concurrency := flag.Int("concurrency", 1, "Run -runs requests on each of this many independent sockets at the same time and report per-worker and aggregate stats")
+	rampConcurrency := flag.Int("ramp-concurrency", 0, "Run -runs requests per worker at concurrency 1, 2, 4, ... up to this value and report the latency knee")
+	reconnect := flag.Bool("reconnect", false, "Open a fresh socket for every request")
+	resolveEach := flag.Bool("resolve-each", false, "Look up the host name again for every fresh socket and report DNS lookup times; implies -reconnect")
+	coldCompare := flag.Bool("cold-compare", false, "Run once on one socket and once with a fresh socket per request, and compare the two")
+	portStudy := flag.Bool("port-study", false, "Reconnect for every request and report how the NAT allocates mapped ports")
+	portSockets := flag.Int("port-sockets", 0, "Open this many sockets at once, one request each, and analyze how predictably the NAT allocates mapped ports")
+	interval := flag.Duration("interval", 0, "Pause between consecutive requests (defaults to 1s with -serve and 30s with -monitor)")
+	serve := flag.String("serve", "", "Probe continuously and serve /metrics and /healthz on this address (e.g. :8080)")
+	monitor := flag.Bool("monitor", false, "Probe continuously at -interval (default 30s) until interrupted, printing rolling summaries and mapped address changes")
+	summaryEvery := flag.Duration("summary-every", defaultSummaryInterval, "How often -monitor prints a rolling summary of the requests since the last one")
+	alertCommand := flag.String("alert-command", "", "Shell command -monitor runs when the mapped address changes, latency shifts or the best of several servers changes, with STUN_TIMING_EVENT and STUN_TIMING_MESSAGE set")
+	rankingFile := flag.String("ranking-file", "", "With -monitor and several -host values, keep the latest server ranking in this JSON file")
+	baseline := flag.Bool("baseline", false, "Also time ICMP echo (or TCP connect) to the host and compare with STUN")
+	serverCapabilities := flag.Bool("server-capabilities", false, "Report whether the server supports OTHER-ADDRESS, RESPONSE-ORIGIN and CHANGE-REQUEST, and which NAT diagnostics it allows")
+	natCheck := flag.Bool("nat-check", false, "Classify the NAT's mapping and filtering behavior with the RFC 5780 tests; needs a server that advertises OTHER-ADDRESS")
+	natMapping := flag.Bool("nat-mapping", false, "Compare the mapped addresses several server addresses see from one socket to classify NAT mapping behavior; takes a comma-separated -host list, or one host that advertises OTHER-ADDRESS")
+	natFiltering := flag.Bool("nat-filtering", false, "Ask the server to answer from its alternate address and port with CHANGE-REQUEST and classify NAT filtering behavior from which responses arrive")
+	hairpin := flag.Bool("hairpin", false, "Send a packet to the socket's own mapped address and report whether the NAT hairpins it back, with the round-trip time")
+	bindingLifetime := flag.Duration("binding-lifetime", 0, "Measure how long the NAT keeps an idle UDP binding, trying idle times up to this long (e.g. 10m); needs a server that supports RESPONSE-PORT")
+	verifyKeepalive := flag.Duration("verify-keepalive", 0, "With -binding-lifetime, send requests at the recommended keepalive interval for this long and check that the mapped address stays the same")
+	blackholeTest := flag.Bool("blackhole-test", false, "Send increasingly large requests and report where path MTU black-holing starts")
+	messagesFile := flag.String("messages-file", "", "Send the hex-encoded STUN messages in this file, one per line, and report each response")
+	statsdAddr := flag.String("statsd", "", "Send per-request timings and error counts to this statsd/DogStatsD address (e.g. 127.0.0.1:8125)")
+	statsdPrefix := flag.String("statsd-prefix", "stun_timing.", "Prefix for statsd metric names")
+	var statsdTags []string
+	flag.Func("statsd-tags", "DogStatsD tags for statsd metrics, as key:value,key:value", func(s string) error {
+		statsdTags = strings.Split(s, ",")
+		return nil
+	})
+	transport := flag.String("transport", "udp", "Transport for binding requests: udp, tcp, tls (also selected by a stuns: host) or dtls")
+	turn := flag.Bool("turn", false, "Time authenticated TURN Allocate requests and data relayed through -host alongside Binding requests (also selected by a turn: or turns: host, with ?transport=tcp for TCP)")
+	turnUser := flag.String("turn-user", "", "TURN username for -turn")
+	turnPass := flag.String("turn-pass", "", "TURN password for -turn (defaults to $TURN_PASSWORD)")
+	turnSecret := flag.String("turn-secret", "", "Shared secret to compute time-limited TURN credentials from, as coturn's use-auth-secret expects (defaults to $TURN_SECRET)")
+	turnTTL := flag.Duration("turn-ttl", defaultTURNTTL, "Lifetime of credentials computed from -turn-secret")
+	user := flag.String("user", "", "Username to authenticate Binding requests with long-term credentials")
+	password := flag.String("password", "", "Password for -user (defaults to $STUN_PASSWORD)")
+	realm := flag.String("realm", "", "Realm the server must announce for -user; by default any realm is accepted")
+	turnRESTURL := flag.String("turn-rest-url", "", "TURN REST API endpoint to fetch time-limited credentials from before the run")
+	tlsInsecure := flag.Bool("tls-insecure", false, "Skip verification of the server's TLS or DTLS certificate")
+	tlsServerName := flag.String("tls-server-name", "", "Server name for TLS SNI and certificate verification (defaults to the host)")
+	tlsCA := flag.String("tls-ca", "", "PEM file of CA certificates to verify the server's TLS certificate against")
+	hgrmPath := flag.String("hgrm", "", "Write the latency distribution to this file in HdrHistogram .hgrm format (values in ms)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "Export metrics to this OpenTelemetry collector over OTLP/HTTP (e.g. http://localhost:4318)")
+	otlp := flag.Bool("otlp", false, "Export metrics over OTLP/HTTP to the collector in $OTEL_EXPORTER_OTLP_ENDPOINT, unless -otlp-endpoint is set")
+	influxURL := flag.String("influx-url", "", "Post samples in InfluxDB line protocol to this write URL (token from $INFLUX_TOKEN)")
+	influxMeasurement := flag.String("influx-measurement", "stun_rtt", "Measurement name for InfluxDB line protocol output")
+	var influxTags [][2]string
+	flag.Func("influx-tags", "Extra tags for InfluxDB line protocol output, as key=value,key=value", func(s string) error {
+		var err error
+		influxTags, err = parseInfluxTags(s)
+		return err
+	})
+	csvPath := flag.String("csv", "", "Write every sample to this CSV file (columns from -fields, default index,timestamp,rtt,error)")
+	showCommand := flag.String("show-command", "", "Print the command line that reproduces the run saved in this JSON report")
+	keepalive := flag.Duration("keepalive", 0, "Send keep-alive style requests 15-25s apart for this long (e.g. 1h) instead of -runs back to back")
+	var sla slaThresholds
+	flag.Func("sla", "p95 threshold for multi-host runs, as 50ms for every host or host=50ms for one (repeatable)", sla.set)
+	noColor := flag.Bool("no-color", false, "Disable colored PASS/FAIL output")
+	checkpointPath := flag.String("checkpoint", "", "Periodically save results to this binary file so an interrupted run can be resumed")
+	checkpointInterval := flag.Duration("checkpoint-interval", 10*time.Second, "How often -checkpoint and -resume flush results to disk")
+	resumePath := flag.String("resume", "", "Continue the run checkpointed in this file, appending new samples to it")
+	stream := flag.Bool("stream", false, "Print each request's result as it completes instead of a progress bar")
+	injectDelay := flag.Duration("inject-delay", 0, "Test aid: add this much artificial delay to every measured request")
+	explainBucket := flag.Int("explain-bucket", 0, "List the samples in this histogram bucket (1 is the fastest)")
+	outliers := flag.Bool("outliers", false, "Flag RTTs more than 3.5 median absolute deviations from the median and list when they occurred")
+	trimOutliers := flag.Bool("trim-outliers", false, "Also summarize the run without the outliers; implies -outliers")
+	var percentiles, tablePercentiles, exportPercentiles []float64
+	flag.Func("percentiles", "Comma-separated percentiles shown in the results table and included in JSON output, e.g. 50,90,99,99.9 (default 0,25,50,75,100)", func(s string) error {
+		var err error
+		percentiles, err = parsePercentiles(s)
+		return err
+	})
+	flag.Func("table-percentiles", "Comma-separated percentiles shown in the results table (defaults to -percentiles)", func(s string) error {
+		var err error
+		tablePercentiles, err = parsePercentiles(s)
+		return err
+	})
+	flag.Func("export-percentiles", "Comma-separated percentiles included in JSON output (defaults to -percentiles)", func(s string) error {
+		var err error
+		exportPercentiles, err = parsePercentiles(s)
+		return err
+	})
+	var fields []sampleField
+	flag.Func("fields", "Comma-separated per-sample fields to include in JSON and CSV output, in order (e.g. timestamp,rtt,txid,host)", func(s string) error {
+		var err error
+		fields, err = parseFields(s)
+		return err
+	})
+	var histCap int
+	flag.Func("hist-cap", "Cap the histogram at this percentile (e.g. p99) and show an overflow bar for the rest", func(s string) error {
+		p, err := strconv.Atoi(strings.TrimPrefix(s, "p"))
+		if err != nil || p < 1 || p > 100 {
+			return fmt.Errorf("want a percentile like p99")
+		}
+		histCap = p
+		return nil
+	})
+	flag.Parse()
+
+	// Secrets from the environment are read only after parsing, so that
+	// they never appear as flag defaults in -h or a report's invocation.
+	if *turnPass == "" {
+		*turnPass = os.Getenv("TURN_PASSWORD")
+	}
+	if *turnSecret == "" {
+		*turnSecret = os.Getenv("TURN_SECRET")
+	}
+	if *password == "" {
+		*password = os.Getenv("STUN_PASSWORD")
+	}
+	// The collector variable is only honored on request, so that an
+	// environment set up for other programs does not start exports. It names
+	// the base URL that all signals share, so the metrics path is appended.
+	if *otlp && *otlpEndpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			fmt.Fprintln(os.Stderr, "Error: -otlp needs -otlp-endpoint or $OTEL_EXPORTER_OTLP_ENDPOINT")
+			os.Exit(1)
+		}
+		*otlpEndpoint = strings.TrimSuffix(base, "/") + "/v1/metrics"
+	}
+
+	if percentiles == nil {
+		percentiles = defaultPercentiles
+	}
+	if tablePercentiles == nil {
+		tablePercentiles = percentiles
+	}
+	if exportPercentiles == nil {
+		exportPercentiles = percentiles
+	}
+
+	if *resumePath != "" {
+		if *checkpointPath != "" {
+			fmt.Fprintln(os.Stderr, "Error: -resume already checkpoints to its file; drop -checkpoint")
+			os.Exit(1)
+		}
+		*checkpointPath = *resumePath
+	}
+
+	ipVersion := 0
+	switch {
+	case *ipv4Only && *ipv6Only:
+		fmt.Fprintln(os.Stderr, "Error: -4 and -6 cannot be combined")
+		os.Exit(1)
+	case *ipv4Only:
+		ipVersion = 4
+	case *ipv6Only:
+		ipVersion = 6
+	}
+	if ipVersion != 0 && *dualStack {
+		fmt.Fprintln(os.Stderr, "Error: -dual-stack measures both families; drop -4 or -6")
+		os.Exit(1)
+	}
+
+	stunHost := defaultSTUNHost
+	if len(hosts) > 0 {
+		stunHost = strings.Join(hosts, ",")
+	}
+
+	runsSet, redirectsSet := false, false
+	flag.Visit(func(f *flag.Flag) {
+		runsSet = runsSet || f.Name == "runs"
+		redirectsSet = redirectsSet || f.Name == "max-redirects"
+	})
+	// Requests sent without waiting all go to one server, so a 300 Try
+	// Alternate response is counted as a failure there.
+	if redirectsSet && *maxRedirects > 0 && (*reorder || rate > 0 || ramp != nil || *maxInflight > 0) {
+		fmt.Fprintln(os.Stderr, "Error: -max-redirects cannot be combined with -reorder, -rate, -ramp or -max-inflight")
+		os.Exit(1)
+	}
+	// -auto checks the tail as well as the median and, unless -runs caps
+	// it, keeps going for as long as that takes.
+	runs, adaptivePercentiles := *runCount, []float64{50}
+	if *auto {
+		adaptivePercentiles = append(adaptivePercentiles, 99)
+		if !runsSet {
+			runs = autoMaxRuns
+		}
+	}
+	if (*discover || *discoverURL != "") && !runsSet {
+		runs = discoverRuns
+	}
+
+	return config{
+		stunHost:   stunHost,
+		runCount:   runs,
+		warmup:     *warmup,
+		duration:   *duration,
+		digestRTTs: *digest,
+		timeout:    *timeout,
+		bucketBy:   *bucketBy,
+		maxRTTDrop: *maxRTTDrop,
+		iface:      *iface,
+		ipVersion:  ipVersion,
+		altSize:    *altSize,
+		format:     *format,
+		output:     *output,
+		decode:     *decode,
+		verbose:    *verbose,
+		required:   required,
+		showCV:     *showCV,
+		showCI:     *showCI,
+		otherAddr:  *otherAddr,
+
+		adaptive:       *adaptive || *auto,
+		adaptiveEvery:  *adaptiveEvery,
+		adaptiveTarget: *adaptiveTarget,
+		rebindAfter:    *rebindAfter,
+		reorder:        *reorder,
+		rate:           rate,
+		ramp:           ramp,
+		maxInflight:    *maxInflight,
+		sendInterval:   *sendInterval,
+
+		adaptivePercentiles: adaptivePercentiles,
+
+		checkTruncation: *checkTruncation,
+		strict:          *strict,
+		maxRedirects:    *maxRedirects,
+		scenario:        *scenario,
+		normalize:       *normalize,
+		vpnCompare:      *vpnCompare,
+		abCompare:       *abCompare,
+		eachIP:          *eachIP,
+		dualStack:       *dualStack,
+		transports:      *transports,
+		htmlPath:        *htmlPath,
+		rampConcurrency: *rampConcurrency,
+		concurrency:     *concurrency,
+		reconnect:       *reconnect || *portStudy || *resolveEach,
+		resolveEach:     *resolveEach,
+		coldCompare:     *coldCompare,
+		throughput:      *throughput,
+		bufferbloat:     *bufferbloat,
+		loadTarget:      *loadTarget,
+		loadRate:        loadRate,
+		portStudy:       *portStudy,
+		portSockets:     *portSockets,
+		interval:        *interval,
+		serve:           *serve,
+		monitor:         *monitor,
+		summaryEvery:    *summaryEvery,
+		alertCommand:    *alertCommand,
+		targetsFile:     *targetsFile,
+		discover:        *discover || *discoverURL != "",
+		discoverURL:     *discoverURL,
+		scoreWeights:    weights,
+		rankingFile:     *rankingFile,
+		histCap:         histCap,
+		baseline:        *baseline,
+		fields:          fields,
+		blackholeTest:   *blackholeTest,
+		natCheck:        *natCheck,
+		serverCaps:      *serverCapabilities,
+		natMapping:      *natMapping,
+		natFiltering:    *natFiltering,
+		hairpin:         *hairpin,
+		bindingLifetime: *bindingLifetime,
+		verifyKeepalive: *verifyKeepalive,
+		messagesFile:    *messagesFile,
+		explainBucket:   *explainBucket,
+		outliers:        *outliers || *trimOutliers,
+		trimOutliers:    *trimOutliers,
+		injectDelay:     *injectDelay,
+		stream:          *stream,
+
+		keepalive:   *keepalive,
+		showCommand: *showCommand,
+		csvPath:     *csvPath,
+
+		statsdAddr:   *statsdAddr,
+		statsdPrefix: *statsdPrefix,
+		statsdTags:   statsdTags,
+
+		otlpEndpoint: *otlpEndpoint,
+		hgrmPath:     *hgrmPath,
+		transport:    *transport,
+
+		turn:        *turn,
+		turnUser:    *turnUser,
+		turnPass:    *turnPass,
+		turnSecret:  *turnSecret,
+		turnTTL:     *turnTTL,
+		turnRESTURL: *turnRESTURL,
+
+		user:     *user,
+		password: *password,
+		realm:    *realm,
+
+		tlsInsecure:   *tlsInsecure,
+		tlsServerName: *tlsServerName,
+		tlsCA:         *tlsCA,
+
+		influxURL:         *influxURL,
+		influxMeasurement: *influxMeasurement,
+		influxTags:        influxTags,
+
+		sla:     sla,
+		noColor: *noColor,
+
+		checkpointPath:     *checkpointPath,
+		checkpointInterval: *checkpointInterval,
+		resume:             *resumePath != "",
+
+		tablePercentiles:  tablePercentiles,
+		exportPercentiles: exportPercentiles,
+	}
+}
+
+func (cfg config) progressBar(max int) *progressbar.ProgressBar {
+	// Streamed lines would be interleaved with the bar's redraws.
+	if cfg.quiet || cfg.stream {
+		return progressbar.DefaultSilent(int64(max))
+	}
+	return progressbar.Default(int64(max))
 }
 
-func main() {
-	cfg := parseFlags()
+// logOutput is where progress messages go. Machine-readable formats keep
+// stdout clean by sending them to stderr instead.
+func (cfg config) logOutput() io.Writer {
+	if cfg.quiet {
+		return io.Discard
+	}
+	if cfg.format == "text" {
+		return os.Stdout
+	}
+	return os.Stderr
+}
 
-	results, err := runSTUNRequests(cfg)
+func runSTUNRequests(cfg config, host string) ([]result, error) {
+	p, err := newProber(cfg, host)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
+	defer p.Close()
 
-	printResults(results)
-	printASCIIHistogram(results)
+	if cfg.warmup > 0 {
+		answered, first, err := p.warmUp(cfg)
+		if err != nil {
+			return nil, err
+		}
+		printWarmUp(cfg, cfg.warmup, answered, first)
+	}
+	return p.run(cfg)
 }
 
-func parseFlags() config {
-	stunHost := flag.String("host", "stun.cloudflare.com:3478", "STUN server hostname")
-	runCount := flag.Int("runs", 1, "Number of times to run the STUN request")
-	timeout := flag.Duration("timeout", 5*time.Second, "Timeout for each STUN request")
-	flag.Parse()
-
-	return config{
-		stunHost: *stunHost,
-		runCount: *runCount,
-		timeout:  *timeout,
+// bindingRequest builds Binding request i of a run: padded as cfg asks,
+// signed with cfg.auth, whose nonce is fetched first if there is none yet,
+// and ending in FINGERPRINT when authenticated or strict.
+func (p *prober) bindingRequest(cfg config, i int) (*stun.Message, error) {
+	setters := append([]stun.Setter{stun.TransactionID, stun.BindingRequest}, requestAttrs(cfg, i)...)
+	if cfg.auth != nil {
+		if cfg.auth.nonce == nil {
+			if err := p.fetchNonce(cfg.auth, stun.BindingRequest, setters[2:]...); err != nil {
+				return nil, fmt.Errorf("failed to authenticate: %w", err)
+			}
+		}
+		setters = append(setters, cfg.auth.setters()...)
 	}
+	if cfg.auth != nil || cfg.strict {
+		setters = append(setters, stun.Fingerprint)
+	}
+	return stun.MustBuild(setters...), nil
+}
+
+// prober owns the socket requests are sent on, so that consecutive runs can
+// share it and a run can deliberately replace it.
+type prober struct {
+	d       *net.Dialer
+	network string
+	host    string
+	addr    string
+	inspect bool
+	timeout time.Duration
+	conn    net.Conn
+	c       *stun.Client
+
+	tls  *tls.Config
+	dtls *dtls.Config
+
+	// setup and handshake are how long the current connection took to
+	// establish, until they are attributed to the first request sent over
+	// it.
+	setup     time.Duration
+	handshake time.Duration
+	// challenge is the time spent fetching a nonce, until it is attributed
+	// to the authenticated request that needed it.
+	challenge time.Duration
+	// lookup is the DNS lookup time of the current socket when resolveEach
+	// is set.
+	lookup      time.Duration
+	resolveEach bool
+	// ipVersion restricts the socket to IPv4 or IPv6 when it is 4 or 6.
+	ipVersion int
+	// resolved are the addresses the host name resolved to for the current
+	// socket, or nil for an IP address.
+	resolved []net.IP
+	// noRetransmit sends every request once, so that each loss shows.
+	noRetransmit bool
+
+	// txids, in strict mode, notices responses that match no request sent.
+	txids *txidTracker
+
+	// indications receives the STUN indications the server sends outside
+	// any transaction, such as TURN Data indications.
+	indications chan indication
 }
 
-func runSTUNRequests(cfg config) ([]result, error) {
-	u, err := stun.ParseURI("stun:" + cfg.stunHost)
+func newProber(cfg config, host string) (*prober, error) {
+	scheme := "stun:"
+	if cfg.transport == "tls" || cfg.transport == "dtls" {
+		scheme = "stuns:"
+	}
+	u, err := stun.ParseURI(scheme + host)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse STUN URI: %w", err)
 	}
 
-	c, err := stun.DialURI(u, &stun.DialConfig{})
+	d, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &prober{
+		d:       d,
+		host:    u.Host,
+		addr:    net.JoinHostPort(u.Host, strconv.Itoa(u.Port)),
+		network: cfg.transport,
+		inspect: cfg.checkTruncation || cfg.strict,
+		timeout: cfg.timeout,
+
+		resolveEach: cfg.resolveEach,
+		ipVersion:   cfg.ipVersion,
+
+		// Inspecting responses needs each request's own outcome, which a
+		// retransmission answered in its place would hide.
+		noRetransmit: cfg.blackholeTest || cfg.checkTruncation || cfg.strict,
+
+		indications: make(chan indication, 16),
+	}
+	if cfg.strict {
+		p.txids = newTxidTracker(cfg.timeout)
+	}
+	switch cfg.transport {
+	case "tls":
+		if p.tls, err = newTLSConfig(cfg, u.Host); err != nil {
+			return nil, err
+		}
+		p.network = "tcp"
+	case "dtls":
+		if p.dtls, err = newDTLSConfig(cfg, u.Host); err != nil {
+			return nil, err
+		}
+		p.network = "udp"
+	}
+	if err := p.dial(); err != nil {
+		return nil, err
+	}
+	if !cfg.quiet {
+		printConnectionFamilies(cfg.logOutput(), p.conn, p.host, p.resolved)
+	}
+	return p, nil
+}
+
+func (p *prober) dial() error {
+	addrs, err := p.dialAddrs()
+	if err != nil {
+		return err
+	}
+	// Like the dialer with a host name, fall back to the next address if
+	// one cannot be reached.
+	start := time.Now()
+	var conn net.Conn
+	for _, addr := range addrs {
+		if conn, err = p.d.Dial(p.network, addr); err == nil {
+			break
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial STUN server: %w", err)
+		return fmt.Errorf("failed to dial STUN server: %w", err)
+	}
+	if p.network == "tcp" {
+		p.setup = time.Since(start)
+	}
+
+	if p.tls != nil {
+		start = time.Now()
+		tlsConn := tls.Client(conn, p.tls)
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		err := tlsConn.HandshakeContext(ctx)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		p.handshake = time.Since(start)
+		conn = tlsConn
+	}
+	if p.dtls != nil {
+		start = time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		dtlsConn, err := dtls.ClientWithContext(ctx, conn, p.dtls)
+		cancel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("DTLS handshake failed: %w", err)
+		}
+		p.handshake = time.Since(start)
+		conn = dtlsConn
+	}
+
+	p.conn, p.c, err = newSTUNClient(conn, p.network == "tcp", p.inspect, p.noRetransmit, p.timeout, p.handleEvent)
+	return err
+}
+
+// redial replaces the socket with a fresh one, normally on a new local port.
+func (p *prober) redial() error {
+	p.c.Close()
+	return p.dial()
+}
+
+func (p *prober) Close() error {
+	return p.c.Close()
+}
+
+// run sends cfg.runCount requests, one at a time, on the prober's socket,
+// or with cfg.duration set, keeps sending until that much time has passed.
+func (p *prober) run(cfg config) ([]result, error) {
+	var results []result
+	var deadline time.Time
+	switch {
+	case cfg.duration > 0:
+		deadline = time.Now().Add(cfg.duration)
+	case cfg.digest == nil:
+		results = make([]result, 0, cfg.runCount)
+	}
+	more := func(i int) bool {
+		if deadline.IsZero() {
+			return i < cfg.runCount
+		}
+		return time.Now().Before(deadline)
+	}
+	collected := 0
+
+	out := cfg.logOutput()
+	if cfg.iface != "" {
+		fmt.Fprintf(out, "Using interface: %s\n", cfg.iface)
+	}
+	if cfg.injectDelay > 0 {
+		fmt.Fprintf(out, "TEST AID: adding %s of artificial delay to every request\n", cfg.injectDelay)
 	}
-	defer c.Close()
+	fmt.Fprintln(out, "Starting STUN requests...")
+	total := cfg.runCount
+	if !deadline.IsZero() {
+		// The number of requests is not known up front.
+		total = -1
+	}
+	bar := cfg.progressBar(total)
+	hooks := cfg.responseHooks(p.addr)
+	redirects := 0
 
-	results := make([]result, cfg.runCount)
+	for i := 0; more(i); i++ {
+		if (cfg.rebindAfter > 0 && i == cfg.rebindAfter) || (cfg.reconnect && i > 0) {
+			if err := p.redial(); err != nil {
+				return nil, fmt.Errorf("failed to reopen socket: %w", err)
+			}
+		}
+		if cfg.interval > 0 && i > 0 {
+			time.Sleep(cfg.pause())
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				break
+			}
+		}
 
-	fmt.Println("Starting STUN requests...")
-	bar := progressbar.Default(int64(cfg.runCount))
+		message, err := p.bindingRequest(cfg, i)
+		if err != nil {
+			return nil, err
+		}
+		if p.txids != nil {
+			p.txids.send(message.TransactionID)
+		}
+		local := currentLocalIP(p.d, p.conn.RemoteAddr())
 
-	for i := 0; i < cfg.runCount; i++ {
-		message := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		var mapped, other *net.UDPAddr
+		var resErr error
+		var alternate string
+		response := message
 
 		start := time.Now()
-		err := c.Do(message, func(res stun.Event) {
+		if cfg.injectDelay > 0 {
+			time.Sleep(cfg.injectDelay)
+		}
+		err = p.c.Do(message, func(res stun.Event) {
 			if res.Error != nil {
+				resErr = res.Error
+				return
+			}
+			if len(hooks) > 0 {
+				// The client reuses res.Message for the next read.
+				response = new(stun.Message)
+				res.Message.CloneTo(response)
+			}
+			if cfg.strict {
+				if resErr = checkFingerprint(res.Message); resErr != nil {
+					return
+				}
+			}
+			if res.Message.Type.Class == stun.ClassErrorResponse {
+				alternate, _ = alternateServer(res.Message)
+				// A stale nonce fails this request and is replaced for
+				// the next one.
+				if cfg.auth != nil {
+					cfg.auth.challenge(res.Message)
+				}
+				resErr = errorResponse(res.Message)
 				return
 			}
 
 			var xorAddr stun.XORMappedAddress
 			if err := xorAddr.GetFrom(res.Message); err != nil {
+				resErr = err
 				return
 			}
+			mapped = &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}
+			other = otherAddress(res.Message)
+			resErr = checkRequiredAttrs(res.Message, cfg.required)
 
 			if i == 0 {
-				fmt.Printf("\nYour IP is: %s\n", xorAddr.IP)
+				fmt.Fprintf(out, "\nYour IP is: %s\n", xorAddr.IP)
 			}
 		})
 
 		elapsed := time.Since(start).Microseconds()
-		results[i] = result{time: elapsed, err: err}
+		_, localPort := addrIPPort(p.conn.LocalAddr())
+		if err == nil {
+			err = resErr
+		}
+		if ic, ok := p.conn.(*inspectConn); ok && err != nil {
+			if rawErr := ic.responseError(message.TransactionID); rawErr != nil {
+				err = rawErr
+			}
+		}
+		if p.txids != nil && p.txids.takeStray() && errors.Is(err, stun.ErrTransactionTimeOut) {
+			err = errUnknownTransaction
+		}
+		if alternate != "" && redirects < cfg.maxRedirects {
+			// Measure the server we were sent to instead; the redirect
+			// itself is only reported.
+			redirects++
+			bar.Clear()
+			fmt.Fprintf(out, "Redirected from %s to %s in %d μs\n", p.addr, alternate, elapsed)
+			if err := p.follow(alternate); err != nil {
+				return nil, fmt.Errorf("failed to follow redirect: %w", err)
+			}
+			i--
+			continue
+		}
+		r := result{
+			index:  i,
+			start:  start,
+			time:   elapsed,
+			err:    err,
+			local:  local,
+			port:   localPort,
+			mapped: mapped,
+			other:  other,
+			size:   len(message.Raw),
+			txid:   message.TransactionID,
+
+			rebound: cfg.rebindAfter > 0 && i == cfg.rebindAfter,
+		}
+		if p.setup > 0 || p.handshake > 0 || p.challenge > 0 || p.lookup > 0 {
+			r.connect, r.handshake, r.challenge = p.setup, p.handshake, p.challenge
+			r.lookup = p.lookup
+			p.setup, p.handshake, p.challenge, p.lookup = 0, 0, 0, 0
+		}
+		if st := sendTimer(p.conn); st != nil {
+			r.sendBlock = st.lastWrite()
+		}
+		if cfg.checkpoint != nil {
+			if err := cfg.checkpoint.record(r); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(hooks) > 0 {
+			bar.Clear()
+			runHooks(hooks, r, response)
+		}
 
 		bar.Add(1)
+		collected++
+
+		// A digest takes the result in place of the slice, so memory stays
+		// bounded however long the run.
+		if cfg.digest != nil {
+			cfg.digest.add(r)
+			continue
+		}
+		results = append(results, r)
+
+		if cfg.adaptive && (i+1)%cfg.adaptiveEvery == 0 && estimatesConverged(results, cfg.adaptiveTarget, cfg.adaptivePercentiles) {
+			break
+		}
 	}
 
-	fmt.Println() // New line after progress bar
+	fmt.Fprintln(out) // New line after progress bar
+	if !deadline.IsZero() {
+		fmt.Fprintf(out, "Collected %d samples in %s\n", collected, cfg.duration)
+	}
 	return results, nil
 }
 
-func printResults(results []result) {
-	var successfulTimes []int64
+// stunAttempts is how many times the STUN client sends a request over UDP
+// before giving up. Attempt n waits n RTOs, so all of them together take
+// stunAttempts*(stunAttempts+1)/2 RTOs.
+const stunAttempts = 7
+
+// newSTUNClient starts a client on conn whose transactions time out after
+// timeout. Over UDP, requests are retransmitted within that time as RFC 5389
+// asks, unless noRetransmit is set for tests that need every loss to show.
+// stream is set for TCP and TLS, where messages have to be framed out of the
+// byte stream and are never retransmitted. h receives messages that do not
+// belong to a transaction.
+func newSTUNClient(conn net.Conn, stream, inspect, noRetransmit bool, timeout time.Duration, h stun.Handler) (net.Conn, *stun.Client, error) {
+	if stream {
+		conn = &streamConn{Conn: conn}
+	}
+	conn = &sendTimingConn{Conn: conn}
+	if inspect {
+		conn = newInspectConn(conn)
+	}
+
+	options := []stun.ClientOption{stun.WithHandler(h)}
+	if stream || noRetransmit {
+		options = append(options, stun.WithRTO(timeout), stun.WithNoRetransmit)
+	} else {
+		options = append(options, stun.WithRTO(timeout/(stunAttempts*(stunAttempts+1)/2)))
+	}
+	c, err := stun.NewClient(conn, options...)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create STUN client: %w", err)
+	}
+	return conn, c, nil
+}
+
+// newDialer returns the dialer used for every socket the tool opens, so that
+// interface binding applies uniformly.
+func newDialer(cfg config) (*net.Dialer, error) {
+	d := &net.Dialer{Timeout: cfg.timeout}
+	if cfg.iface != "" {
+		control, err := bindToDevice(cfg.iface)
+		if err != nil {
+			return nil, err
+		}
+		d.Control = control
+	}
+	return d, nil
+}
+
+// currentLocalIP returns the source address the OS would currently pick to
+// reach remote. Comparing it across requests reveals local network changes
+// that a long-lived connected socket would otherwise hide.
+func currentLocalIP(d *net.Dialer, remote net.Addr) net.IP {
+	probe, err := d.Dial("udp", remote.String())
+	if err != nil {
+		return nil
+	}
+	defer probe.Close()
+	return probe.LocalAddr().(*net.UDPAddr).IP
+}
+
+// dropImplausible removes successful samples faster than floor. Such samples
+// usually come from cached or spoofed responses and would corrupt p0.
+func dropImplausible(results []result, floor time.Duration) ([]result, int) {
+	kept := results[:0]
+	dropped := 0
+	for _, r := range results {
+		if r.err == nil && r.time < floor.Microseconds() {
+			dropped++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, dropped
+}
+
+// normalizeResults rewrites every successful time as its distance above the
+// fastest sample, removing the fixed propagation delay. It returns that
+// minimum so absolute values can be reconstructed.
+func normalizeResults(results []result) int64 {
+	minTime := int64(-1)
+	for _, r := range results {
+		if r.err == nil && (minTime < 0 || r.time < minTime) {
+			minTime = r.time
+		}
+	}
+	if minTime < 0 {
+		return 0
+	}
+
+	for i := range results {
+		if results[i].err == nil {
+			results[i].time -= minTime
+		}
+	}
+	return minTime
+}
+
+// coldStartIndex returns the position in results of the cold-start request,
+// the first successful one, which pays for ARP/NDP, route lookups and any
+// middlebox state setup. It returns -1 when there is no separate cold start:
+// after a warm-up, which has already paid for it, or when it is the only
+// successful request and so the only sample there is.
+func coldStartIndex(results []result, warmedUp bool) int {
+	if warmedUp {
+		return -1
+	}
+	first, successful := -1, 0
+	for i, r := range results {
+		if r.err == nil {
+			if first < 0 {
+				first = i
+			}
+			successful++
+		}
+	}
+	if successful < 2 {
+		return -1
+	}
+	return first
+}
+
+func printResults(cfg config, results []result) {
+	var successfulTimes, warmTimes []int64
 	var errorCount int
+	var incomplete []*incompleteError
+	cold := coldStartIndex(results, cfg.warmup > 0)
 
 	for i, r := range results {
+		var ie *incompleteError
+		if errors.As(r.err, &ie) {
+			incomplete = append(incomplete, ie)
+			continue
+		}
 		if r.err != nil {
 			errorCount++
 			continue
 		}
-
 		successfulTimes = append(successfulTimes, r.time)
-
-		if i == 0 {
-			fmt.Printf("First request time: %d μs\n", r.time)
+		if i != cold {
+			warmTimes = append(warmTimes, r.time)
 		}
 	}
 
 	if len(successfulTimes) == 0 {
 		fmt.Println("No successful requests")
+		for _, r := range results {
+			if r.err != nil {
+				fmt.Printf("First error: %v\n", r.err)
+				break
+			}
+		}
+		if len(incomplete) > 0 {
+			printIncomplete(incomplete)
+		}
 		return
 	}
 
-	sort.Slice(successfulTimes, func(i, j int) bool { return successfulTimes[i] < successfulTimes[j] })
+	// Jitter depends on the order the samples were taken in.
+	warmJitter := jitter(warmTimes)
+	sort.Slice(warmTimes, func(i, j int) bool { return warmTimes[i] < warmTimes[j] })
 
 	fmt.Println("\nResults:")
 	fmt.Printf("Successful requests: %d\n", len(successfulTimes))
-	fmt.Printf("Failed requests: %d\n\n", errorCount)
+	fmt.Printf("Failed requests: %d\n", errorCount)
+	if len(incomplete) > 0 {
+		printIncomplete(incomplete)
+	}
+	if cold >= 0 {
+		fmt.Printf("Cold-start RTT: %d μs\n", results[cold].time)
+	}
+	fmt.Printf("NAT: %s\n", firstNATVerdict(results))
+	if cfg.injectDelay > 0 {
+		fmt.Printf("TEST AID: times include %s of injected delay\n", cfg.injectDelay)
+	}
+	fmt.Println()
+
+	if cold >= 0 {
+		fmt.Println("Warm requests:")
+	}
+	if cfg.showCI {
+		printPercentileCIs(cfg.tablePercentiles, warmTimes)
+	} else {
+		fmt.Println("┌───────┬───────────┐")
+		fmt.Printf("│ %%tile │ Time (μs) │\n")
+		fmt.Println("├───────┼───────────┤")
+		for _, p := range cfg.tablePercentiles {
+			fmt.Printf("│ %-5s │ %9d │\n", percentileCell(p), percentile(warmTimes, p))
+		}
+		fmt.Println("└───────┴───────────┘")
+	}
 
-	fmt.Println("┌───────┬───────────┐")
-	fmt.Println("│ %tile │ Time (μs) │")
-	fmt.Println("├───────┼───────────┤")
-	fmt.Printf("│  p0   │ %9d │\n", successfulTimes[0])
-	fmt.Printf("│  p25  │ %9d │\n", percentile(successfulTimes, 25))
-	fmt.Printf("│  p50  │ %9d │\n", percentile(successfulTimes, 50))
-	fmt.Printf("│  p75  │ %9d │\n", percentile(successfulTimes, 75))
-	fmt.Printf("│ p100  │ %9d │\n", successfulTimes[len(successfulTimes)-1])
-	fmt.Println("└───────┴───────────┘")
+	m, sd := mean(warmTimes), stddev(warmTimes)
+	fmt.Printf("\nMean: %.0f μs\n", m)
+	fmt.Printf("Std dev: %.0f μs\n", sd)
+	fmt.Printf("Jitter (RFC 3550): %.0f μs\n", warmJitter)
+	if cfg.showCV {
+		fmt.Printf("Coefficient of variation: %.3f\n", sd/m)
+	}
 }
 
-func percentile(sorted []int64, p int) int64 {
-	index := int(math.Round(float64(len(sorted)-1) * float64(p) / 100))
-	return sorted[index]
+// percentile returns the p-th percentile of sorted, interpolating linearly
+// between the two samples around it, so that tail percentiles like p99.9
+// move smoothly with the data instead of jumping between samples.
+func percentile(sorted []int64, p float64) int64 {
+	pos := float64(len(sorted)-1) * p / 100
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + int64(math.Round(float64(sorted[hi]-sorted[lo])*(pos-float64(lo))))
 }
 
-func printASCIIHistogram(results []result) {
-	var successfulTimes []int64
-	for _, r := range results {
-		if r.err == nil {
-			successfulTimes = append(successfulTimes, r.time)
-		}
-	}
+type histogramBucket struct {
+	Start int64 `json:"start_us"`
+	End   int64 `json:"end_us"`
+	Count int   `json:"count"`
+}
 
-	if len(successfulTimes) == 0 {
-		return
-	}
+// histogramRange describes equal-width buckets spanning a set of times.
+type histogramRange struct {
+	min  int64
+	size float64
+	n    int
+}
 
+func newHistogramRange(times []int64, numBuckets int) histogramRange {
 	// Determine min and max times
-	minTime, maxTime := successfulTimes[0], successfulTimes[0]
-	for _, t := range successfulTimes {
+	minTime, maxTime := times[0], times[0]
+	for _, t := range times {
 		if t < minTime {
 			minTime = t
 		}
@@ -162,34 +1814,280 @@ func printASCIIHistogram(results []result) {
 			maxTime = t
 		}
 	}
+	return histogramRange{min: minTime, size: float64(maxTime-minTime) / float64(numBuckets), n: numBuckets}
+}
+
+// bucket returns the index of the bucket t falls into.
+func (h histogramRange) bucket(t int64) int {
+	bucket := 0
+	if h.size > 0 {
+		bucket = int(float64(t-h.min) / h.size)
+	}
+	if bucket == h.n {
+		bucket--
+	}
+	return bucket
+}
+
+// computeHistogram splits the range of times into numBuckets equal-width
+// buckets.
+func computeHistogram(times []int64, numBuckets int) []histogramBucket {
+	h := newHistogramRange(times, numBuckets)
 
 	// Create buckets
-	numBuckets := 20
-	bucketSize := float64(maxTime-minTime) / float64(numBuckets)
-	buckets := make([]int, numBuckets)
+	buckets := make([]histogramBucket, numBuckets)
+	for i := range buckets {
+		buckets[i].Start = int64(float64(i)*h.size) + h.min
+		buckets[i].End = int64(float64(i+1)*h.size) + h.min
+	}
+
+	for _, t := range times {
+		buckets[h.bucket(t)].Count++
+	}
+
+	return buckets
+}
+
+// histogramTimes returns the warm successful times the ASCII histogram is
+// drawn from, the same ones the percentiles cover. With -hist-cap, samples
+// above the cap are left out and counted as overflow instead of stretching
+// the range.
+func histogramTimes(cfg config, results []result) (times []int64, capValue int64, overflow int) {
+	cold := coldStartIndex(results, cfg.warmup > 0)
+	for i, r := range results {
+		if r.err == nil && i != cold {
+			times = append(times, r.time)
+		}
+	}
+
+	if cfg.histCap == 0 || len(times) == 0 {
+		return times, 0, 0
+	}
+
+	sorted := append([]int64(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	capValue = percentile(sorted, float64(cfg.histCap))
 
-	for _, t := range successfulTimes {
-		bucket := int(float64(t-minTime) / bucketSize)
-		if bucket == numBuckets {
-			bucket--
+	kept := times[:0]
+	for _, t := range times {
+		if t > capValue {
+			overflow++
+			continue
 		}
-		buckets[bucket]++
+		kept = append(kept, t)
+	}
+	return kept, capValue, overflow
+}
+
+func printASCIIHistogram(cfg config, results []result) {
+	successfulTimes, capValue, overflow := histogramTimes(cfg, results)
+	if len(successfulTimes) == 0 {
+		return
 	}
 
+	buckets := computeHistogram(successfulTimes, histogramBuckets)
+
 	// Find max bucket count for scaling
-	maxCount := 0
-	for _, count := range buckets {
-		if count > maxCount {
-			maxCount = count
+	maxCount := overflow
+	for _, b := range buckets {
+		if b.Count > maxCount {
+			maxCount = b.Count
 		}
 	}
 
 	// Print histogram
 	fmt.Println("\nLatency Distribution (μs):")
-	for i, count := range buckets {
-		start := int64(float64(i)*bucketSize) + minTime
-		end := int64(float64(i+1)*bucketSize) + minTime
-		bar := strings.Repeat("█", count*40/maxCount)
-		fmt.Printf("%6d - %6d | %-40s | %d\n", start, end, bar, count)
+	for _, b := range buckets {
+		bar := strings.Repeat("█", b.Count*40/maxCount)
+		fmt.Printf("%6d - %6d | %-40s | %d\n", b.Start, b.End, bar, b.Count)
+	}
+	if cfg.histCap > 0 {
+		bar := strings.Repeat("█", overflow*40/maxCount)
+		fmt.Printf("%6s > %6d | %-40s | %d\n", "", capValue, bar, overflow)
+	}
+}
+
+// histogramBuckets is the number of buckets in the latency histogram.
+const histogramBuckets = 20
+
+// printBucketSamples lists the samples that fell into the given 1-based
+// histogram bucket, so an unexpectedly busy bar can be traced back to
+// individual requests.
+func printBucketSamples(cfg config, results []result, n int) {
+	times, capValue, _ := histogramTimes(cfg, results)
+	if len(times) == 0 {
+		return
+	}
+	if n < 1 || n > histogramBuckets {
+		fmt.Printf("\nBucket %d does not exist (buckets are numbered 1-%d)\n", n, histogramBuckets)
+		return
+	}
+
+	h := newHistogramRange(times, histogramBuckets)
+	bucket := computeHistogram(times, histogramBuckets)[n-1]
+
+	fmt.Printf("\nSamples in bucket %d (%d - %d μs):\n", n, bucket.Start, bucket.End)
+	cold := coldStartIndex(results, cfg.warmup > 0)
+	for i, r := range results {
+		if r.err != nil || i == cold || (cfg.histCap > 0 && r.time > capValue) || h.bucket(r.time) != n-1 {
+			continue
+		}
+		fmt.Printf("  request #%d at %s: %d μs\n", r.index, r.start.Format("15:04:05.000000"), r.time)
+	}
+}
+
+// timeWindow holds the results that started within one wall-clock window.
+type timeWindow struct {
+	start  time.Time
+	times  []int64
+	failed int
+}
+
+// loss is the percentage of the window's requests that failed.
+func (w timeWindow) loss() float64 {
+	return float64(w.failed) / float64(len(w.times)+w.failed) * 100
+}
+
+// timeWindows groups results into wall-clock windows of the given size, in
+// order, with each window's successful times sorted.
+func timeWindows(results []result, window time.Duration) []timeWindow {
+	var windows []timeWindow
+	byStart := make(map[time.Time]int)
+
+	for _, r := range results {
+		w := r.start.Truncate(window)
+		i, ok := byStart[w]
+		if !ok {
+			i = len(windows)
+			byStart[w] = i
+			windows = append(windows, timeWindow{start: w})
+		}
+		if r.err != nil {
+			windows[i].failed++
+			continue
+		}
+		windows[i].times = append(windows[i].times, r.time)
+	}
+
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start.Before(windows[j].start) })
+	for _, w := range windows {
+		sort.Slice(w.times, func(i, j int) bool { return w.times[i] < w.times[j] })
+	}
+	return windows
+}
+
+func printTimeWindows(results []result, window time.Duration) {
+	windows := timeWindows(results, window)
+	if len(windows) == 0 {
+		return
+	}
+	// Runs spanning more than a day need the date to tell windows apart.
+	layout := "15:04:05"
+	if windows[0].start.YearDay() != windows[len(windows)-1].start.YearDay() || windows[0].start.Year() != windows[len(windows)-1].start.Year() {
+		layout = "01-02 15:04"
+	}
+
+	fmt.Printf("\nResults per %s window (μs):\n", window)
+	fmt.Println("┌─────────────┬────────┬────────┬────────┬───────────┬───────────┬───────────┬───────────┐")
+	fmt.Println("│   Window    │   OK   │ Failed │ Loss % │    p50    │    p90    │    p99    │   p100    │")
+	fmt.Println("├─────────────┼────────┼────────┼────────┼───────────┼───────────┼───────────┼───────────┤")
+	for _, w := range windows {
+		if len(w.times) == 0 {
+			fmt.Printf("│ %11s │ %6d │ %6d │ %6.1f │ %9s │ %9s │ %9s │ %9s │\n",
+				w.start.Format(layout), 0, w.failed, w.loss(), "-", "-", "-", "-")
+			continue
+		}
+		fmt.Printf("│ %11s │ %6d │ %6d │ %6.1f │ %9d │ %9d │ %9d │ %9d │\n",
+			w.start.Format(layout), len(w.times), w.failed, w.loss(),
+			percentile(w.times, 50), percentile(w.times, 90), percentile(w.times, 99), w.times[len(w.times)-1])
+	}
+	fmt.Println("└─────────────┴────────┴────────┴────────┴───────────┴───────────┴───────────┴───────────┘")
+}
+
+type rebind struct {
+	index int
+	at    time.Time
+	// kind is "local address", "mapped IP" or "mapped port"; a mapped
+	// address whose IP changed is reported as "mapped IP" even if its port
+	// changed too.
+	kind string
+	from string
+	to   string
+}
+
+// detectRebinds reports every point where the local source address or the
+// server-reflexive address differs from the previous successful request, so
+// that a public IP rotated by the ISP mid-run shows up with its time. The
+// new mapping after a -rebind-after is the tool's own doing and is left out.
+func detectRebinds(results []result) []rebind {
+	var events []rebind
+	var lastLocal net.IP
+	var lastMapped *net.UDPAddr
+
+	for _, r := range results {
+		if r.rebound {
+			lastMapped = nil
+		}
+		if r.local != nil {
+			if lastLocal != nil && !r.local.Equal(lastLocal) {
+				events = append(events, rebind{index: r.index, at: r.start, kind: "local address", from: lastLocal.String(), to: r.local.String()})
+			}
+			lastLocal = r.local
+		}
+
+		if r.err != nil || r.mapped == nil {
+			continue
+		}
+		if lastMapped != nil && r.mapped.String() != lastMapped.String() {
+			kind := "mapped port"
+			if !r.mapped.IP.Equal(lastMapped.IP) {
+				kind = "mapped IP"
+			}
+			events = append(events, rebind{index: r.index, at: r.start, kind: kind, from: lastMapped.String(), to: r.mapped.String()})
+		}
+		lastMapped = r.mapped
+	}
+
+	return events
+}
+
+func printRebinds(results []result) {
+	events := detectRebinds(results)
+	if len(events) == 0 {
+		return
+	}
+
+	fmt.Printf("\nRebinds detected: %d\n", len(events))
+	for _, e := range events {
+		fmt.Printf("  request #%d at %s: %s changed %s -> %s\n", e.index, e.at.Format(time.RFC3339), e.kind, e.from, e.to)
+	}
+}
+
+// printRebindAfter compares the last mapping before a deliberate -rebind-after
+// with the first one after it, to show whether the NAT kept the mapping.
+func printRebindAfter(results []result, n int) {
+	var before, after *result
+	for i := range results {
+		r := &results[i]
+		if r.err != nil || r.mapped == nil {
+			continue
+		}
+		if r.index < n {
+			before = r
+		} else if after == nil {
+			after = r
+		}
+	}
+
+	if before == nil || after == nil {
+		fmt.Printf("\nRebind after request #%d: not enough successful responses to compare\n", n)
+		return
+	}
+
+	fmt.Printf("\nRebind after request #%d: local port %d -> %d\n", n, before.port, after.port)
+	if before.mapped.String() == after.mapped.String() {
+		fmt.Printf("Mapped address unchanged: %s\n", after.mapped)
+	} else {
+		fmt.Printf("Mapped address changed: %s -> %s\n", before.mapped, after.mapped)
 	}
 }
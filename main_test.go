@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []int64
+		p      float64
+		want   int64
+	}{
+		{[]int64{42}, 0, 42},
+		{[]int64{42}, 99.9, 42},
+		{[]int64{10, 20, 30, 40}, 0, 10},
+		{[]int64{10, 20, 30, 40}, 25, 18},
+		{[]int64{10, 20, 30, 40}, 50, 25},
+		{[]int64{10, 20, 30, 40}, 90, 37},
+		{[]int64{10, 20, 30, 40}, 100, 40},
+		{[]int64{0, 1000}, 99.9, 999},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %d, want %d", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
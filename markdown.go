@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printMarkdownReport prints the summary as GitHub-flavored Markdown, ready
+// to paste into an issue.
+func printMarkdownReport(cfg config, results []result) {
+	report := buildJSONReport(results, cfg.tablePercentiles, cfg.warmup > 0)
+
+	fmt.Printf("### STUN timing: %s\n\n", cfg.stunHost)
+	fmt.Printf("- Successful requests: %d\n", report.Successful)
+	fmt.Printf("- Failed requests: %d\n", report.Failed)
+	if report.Successful == 0 {
+		return
+	}
+	if report.ColdStart != nil {
+		fmt.Printf("- Cold-start RTT: %d μs\n", *report.ColdStart)
+	}
+	if report.MappedIP != "" {
+		fmt.Printf("- Mapped IP: %s\n", report.MappedIP)
+	}
+
+	if len(report.Percentiles) > 0 {
+		fmt.Printf("\n| %%tile | Time (μs) |\n")
+		fmt.Println("|------:|----------:|")
+		for _, p := range report.Percentiles {
+			fmt.Printf("| %s | %d |\n", percentileLabel(p.Percentile), p.Time)
+		}
+	}
+
+	maxCount := 0
+	for _, b := range report.Histogram {
+		maxCount = max(maxCount, b.Count)
+	}
+	fmt.Println("\n| Latency (μs) | Distribution | Count |")
+	fmt.Println("|-------------:|:-------------|------:|")
+	for _, b := range report.Histogram {
+		fmt.Printf("| %d - %d | %s | %d |\n", b.Start, b.End, strings.Repeat("█", b.Count*20/maxCount), b.Count)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+type rawMessage struct {
+	line int
+	data []byte
+}
+
+// loadMessages reads one hex-encoded STUN message per line. Blank lines and
+// lines starting with # are ignored; lines that are not valid hex are
+// reported and skipped.
+func loadMessages(path string) ([]rawMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open messages file: %w", err)
+	}
+	defer f.Close()
+
+	var messages []rawMessage
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		data, err := hex.DecodeString(strings.ReplaceAll(text, " ", ""))
+		if err != nil {
+			fmt.Printf("Line %d: skipping invalid hex: %v\n", line, err)
+			continue
+		}
+		messages = append(messages, rawMessage{line: line, data: data})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages file: %w", err)
+	}
+	return messages, nil
+}
+
+// responseClass describes a reply for the -messages-file report.
+func responseClass(b []byte) string {
+	m := &stun.Message{Raw: append([]byte(nil), b...)}
+	if err := m.Decode(); err != nil {
+		if rawErr := classifyRaw(b); rawErr == errTruncated {
+			return "truncated STUN message"
+		}
+		return "non-STUN response"
+	}
+
+	switch m.Type.Class {
+	case stun.ClassSuccessResponse:
+		return "success response"
+	case stun.ClassErrorResponse:
+		var code stun.ErrorCodeAttribute
+		if err := code.GetFrom(m); err == nil {
+			return fmt.Sprintf("error response %d %s", code.Code, code.Reason)
+		}
+		return "error response"
+	case stun.ClassIndication:
+		return "indication"
+	default:
+		return "request"
+	}
+}
+
+// runMessagesFile sends each raw message in turn and reports how, and how
+// quickly, the server answered it.
+func runMessagesFile(cfg config) error {
+	messages, err := loadMessages(cfg.messagesFile)
+	if err != nil {
+		return err
+	}
+
+	u, err := stun.ParseURI("stun:" + cfg.stunHost)
+	if err != nil {
+		return fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	d, err := newDialer(cfg)
+	if err != nil {
+		return err
+	}
+	addr, err := resolveFamily(net.JoinHostPort(u.Host, strconv.Itoa(u.Port)), cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+	conn, err := d.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to dial STUN server: %w", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 64*1024)
+	for _, msg := range messages {
+		start := time.Now()
+		if _, err := conn.Write(msg.data); err != nil {
+			fmt.Printf("Line %d: send failed: %v\n", msg.line, err)
+			continue
+		}
+
+		// Replies are matched on the transaction ID when the message is long
+		// enough to carry one; otherwise the first reply is taken.
+		var txid []byte
+		if len(msg.data) >= stunHeaderSize {
+			txid = msg.data[8:stunHeaderSize]
+		}
+
+		conn.SetReadDeadline(start.Add(cfg.timeout))
+		class := "no response"
+		var elapsed time.Duration
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if txid != nil && n >= stunHeaderSize && !bytes.Equal(buf[8:stunHeaderSize], txid) {
+				continue
+			}
+			elapsed = time.Since(start)
+			class = responseClass(buf[:n])
+			break
+		}
+
+		if class == "no response" {
+			fmt.Printf("Line %d (%d bytes): no response within %s\n", msg.line, len(msg.data), cfg.timeout)
+			continue
+		}
+		fmt.Printf("Line %d (%d bytes): %s in %d μs\n", msg.line, len(msg.data), class, elapsed.Microseconds())
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Monitoring probes every defaultMonitorInterval unless -interval is set,
+// and prints a rolling summary every defaultSummaryInterval unless
+// -summary-every is set.
+const (
+	defaultMonitorInterval = 30 * time.Second
+	defaultSummaryInterval = 10 * time.Minute
+)
+
+// monitorWindow counts the results between two rolling summaries. RTTs go
+// into a digest rather than a slice, so a window costs the same however
+// short the interval.
+type monitorWindow struct {
+	start    time.Time
+	requests int
+	failed   int
+	rtts     rttDigest
+}
+
+func (w *monitorWindow) add(r result) {
+	w.requests++
+	if r.err != nil {
+		w.failed++
+		return
+	}
+	w.rtts.add(r.time)
+}
+
+// summary formats the window as one line: request and failure counts and
+// the RTT percentiles of its successful requests.
+func (w *monitorWindow) summary() string {
+	line := fmt.Sprintf("%s  last %s: %d requests, %d failed (%.1f%% loss)",
+		time.Now().Format(time.RFC3339), time.Since(w.start).Round(time.Second), w.requests, w.failed,
+		float64(w.failed)/float64(max(w.requests, 1))*100)
+	return line + w.rtts.summary()
+}
+
+// runMonitor probes the server every cfg.interval on one socket until
+// SIGINT or SIGTERM, printing a rolling summary every cfg.summaryEvery and
+// a line as soon as the mapped address changes or the latency shifts or
+// trends up, which also runs cfg.alertCommand. No results are kept, only
+// digests of their RTTs, so it can run indefinitely.
+func runMonitor(cfg config) error {
+	interval := cfg.interval
+	if interval <= 0 {
+		interval = defaultMonitorInterval
+	}
+	summaryEvery := cfg.summaryEvery
+	if summaryEvery <= 0 {
+		summaryEvery = defaultSummaryInterval
+	}
+	if strings.Contains(cfg.stunHost, ",") {
+		return runMonitorHosts(cfg, interval, summaryEvery)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	fmt.Printf("Monitoring %s every %s, summary every %s (Ctrl-C to stop)\n", cfg.stunHost, interval, summaryEvery)
+
+	probeCfg := cfg
+	probeCfg.runCount = 1
+	probeCfg.duration = 0
+	probeCfg.interval = 0
+	probeCfg.quiet = true
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	notify := func(at time.Time, event, message string) {
+		fmt.Printf("%s  %s\n", at.Format(time.RFC3339), message)
+		runAlertCommand(cfg.alertCommand, event, message)
+	}
+
+	window := &monitorWindow{start: time.Now()}
+	overall := &monitorWindow{start: time.Now()}
+	var trend trendDetector
+	var last result
+	for {
+		results, err := p.run(probeCfg)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			window.add(r)
+			overall.add(r)
+			if r.err != nil {
+				continue
+			}
+			// Compare with the previous successful request, which may be
+			// from an earlier window.
+			for _, e := range detectRebinds([]result{last, r}) {
+				notify(r.start, "mapped-address", fmt.Sprintf("%s changed %s -> %s", e.kind, e.from, e.to))
+			}
+			last = r
+			if notice := trend.add(r.time); notice != "" {
+				notify(r.start, "level-shift", notice)
+			}
+		}
+		if time.Since(window.start) >= summaryEvery {
+			fmt.Println(window.summary())
+			if window.rtts.total > 0 {
+				if notice := trend.endWindow(window.rtts.mean()); notice != "" {
+					notify(time.Now(), "trend", notice)
+				}
+			}
+			window = &monitorWindow{start: time.Now()}
+		}
+
+		select {
+		case <-ctx.Done():
+			if window.requests > 0 {
+				fmt.Println(window.summary())
+			}
+			fmt.Printf("Stopped after %s: %d requests, %d failed%s\n",
+				time.Since(overall.start).Round(time.Second), overall.requests, overall.failed, overall.rtts.summary())
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultSTUNHost is the server measured when -host is not given.
+const defaultSTUNHost = "stun.cloudflare.com:3478"
+
+// slaThresholds are the p95 limits hosts are checked against in multi-host
+// mode: a default for every host, optionally overridden per host.
+type slaThresholds struct {
+	all     time.Duration
+	perHost map[string]time.Duration
+}
+
+// set parses either a bare duration (the default for every host) or
+// host=duration.
+func (s *slaThresholds) set(value string) error {
+	host, limit, perHost := strings.Cut(value, "=")
+	if !perHost {
+		limit = host
+	}
+	d, err := time.ParseDuration(limit)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("want a duration like 50ms or host=50ms")
+	}
+	if !perHost {
+		s.all = d
+		return nil
+	}
+	if s.perHost == nil {
+		s.perHost = make(map[string]time.Duration)
+	}
+	s.perHost[host] = d
+	return nil
+}
+
+func (s slaThresholds) forHost(host string) (time.Duration, bool) {
+	if d, ok := s.perHost[host]; ok {
+		return d, true
+	}
+	return s.all, s.all > 0
+}
+
+// runMultiHost measures each host given with -host in turn, then ranks and
+// reports them.
+func runMultiHost(cfg config) error {
+	var rows []comparisonRow
+	for _, host := range strings.Split(cfg.stunHost, ",") {
+		host = strings.TrimSpace(host)
+		fmt.Fprintf(cfg.logOutput(), "\n== %s ==\n", host)
+		results, err := runSTUNRequests(cfg, host)
+		if err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+		rows = append(rows, comparisonRow{label: host, uri: stunURI(host, cfg.transport), results: results})
+	}
+	return reportHosts(cfg, rows)
+}
+
+// reportHosts ranks the hosts, prints them side by side with a
+// recommendation and checks them against their SLA thresholds. With -format
+// json it writes the ranking as JSON instead.
+func reportHosts(cfg config, rows []comparisonRow) error {
+	hosts := rankHosts(rows, cfg.scoreWeights)
+	if cfg.format == "json" {
+		return writeJSONReport(cfg, buildJSONRanking(cfg, hosts))
+	}
+
+	fmt.Println()
+	printServerComparison(hosts)
+	if cfg.scoreWeights != defaultScoreWeights {
+		fmt.Printf("Score weights: %s\n", cfg.scoreWeights)
+	}
+	if reason, ok := recommendation(hosts, cfg.scoreWeights); ok {
+		fmt.Printf("\nRecommended: %s — %s\n", hosts[0].label, reason)
+	}
+
+	if cfg.sla.all == 0 && len(cfg.sla.perHost) == 0 {
+		return nil
+	}
+
+	color := useColor(cfg)
+	width := 0
+	for _, h := range hosts {
+		width = max(width, len(h.label))
+	}
+	fmt.Println("\nSLA summary (p95):")
+	for _, h := range hosts {
+		limit, ok := cfg.sla.forHost(h.label)
+		if !ok {
+			fmt.Printf("  %-4s  %-*s  no threshold\n", "-", width, h.label)
+			continue
+		}
+		status := "PASS"
+		if !h.ok || time.Duration(h.p95)*time.Microsecond > limit {
+			status = "FAIL"
+		}
+		p95Text := "-"
+		if h.ok {
+			p95Text = fmt.Sprint(h.p95)
+		}
+		fmt.Printf("  %s  %-*s  p95 %7s μs (threshold %d μs)\n", colorStatus(status, color), width, h.label, p95Text, limit.Microseconds())
+	}
+	return nil
+}
+
+// useColor reports whether output may contain ANSI colors: not disabled by
+// -no-color or NO_COLOR, and stdout is a terminal.
+func useColor(cfg config) bool {
+	if cfg.noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func colorStatus(status string, color bool) string {
+	if !color {
+		return status
+	}
+	if status == "PASS" {
+		return "\033[32m" + status + "\033[0m"
+	}
+	return "\033[31m" + status + "\033[0m"
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// natAttempts is how many times a NAT behavior test request is sent within
+// the timeout before the test counts as unanswered, so that one lost packet
+// is not mistaken for filtering.
+const natAttempts = 3
+
+// CHANGE-REQUEST flags (RFC 5780, section 7.2).
+const (
+	changeIP   = 0x04
+	changePort = 0x02
+)
+
+var errNoResponse = errors.New("no response")
+
+func changeRequest(flags byte) stun.RawAttribute {
+	return stun.RawAttribute{Type: stun.AttrChangeRequest, Value: []byte{0, 0, 0, flags}}
+}
+
+// natTest is one Binding transaction of the NAT behavior discovery.
+type natTest struct {
+	name string
+	to   *net.UDPAddr
+	// change holds the CHANGE-REQUEST flags sent, if any.
+	change byte
+
+	mapped *net.UDPAddr
+	other  *net.UDPAddr
+	// from is where the response came from, which differs from to when the
+	// server was asked to change address or port.
+	from *net.UDPAddr
+	// origin is the RESPONSE-ORIGIN the server reported, if any.
+	origin *net.UDPAddr
+	rtt    time.Duration
+	err    error
+}
+
+// natSocket is an unconnected UDP socket, so that responses from any of the
+// server's addresses are received.
+type natSocket struct {
+	d       *net.Dialer
+	conn    net.PacketConn
+	timeout time.Duration
+}
+
+func listenNAT(cfg config) (*natSocket, error) {
+	d, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	lc := net.ListenConfig{Control: d.Control}
+	conn, err := lc.ListenPacket(context.Background(), "udp", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open socket: %w", err)
+	}
+	return &natSocket{d: d, conn: conn, timeout: cfg.timeout}, nil
+}
+
+func (s *natSocket) Close() error {
+	return s.conn.Close()
+}
+
+// run performs t, filling in its outcome. The request is retransmitted
+// natAttempts times within the socket's timeout; the RTT is measured from
+// the last transmission.
+func (s *natSocket) run(t *natTest) {
+	setters := []stun.Setter{stun.TransactionID, stun.BindingRequest}
+	if t.change != 0 {
+		setters = append(setters, changeRequest(t.change))
+	}
+	setters = append(setters, stun.Fingerprint)
+	req := stun.MustBuild(setters...)
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < natAttempts; attempt++ {
+		start := time.Now()
+		if _, err := s.conn.WriteTo(req.Raw, t.to); err != nil {
+			t.err = err
+			return
+		}
+		deadline := start.Add(s.timeout / natAttempts)
+		s.conn.SetReadDeadline(deadline)
+		for {
+			n, from, err := s.conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			res := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+			if res.Decode() != nil || res.TransactionID != req.TransactionID {
+				continue
+			}
+			t.rtt = time.Since(start)
+			t.from = from.(*net.UDPAddr)
+			if res.Type.Class == stun.ClassErrorResponse {
+				t.err = errorResponse(res)
+				return
+			}
+			var xorAddr stun.XORMappedAddress
+			if err := xorAddr.GetFrom(res); err != nil {
+				t.err = err
+				return
+			}
+			t.mapped = &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}
+			t.other = otherAddress(res)
+			var origin stun.ResponseOrigin
+			if origin.GetFrom(res) == nil {
+				t.origin = &net.UDPAddr{IP: origin.IP, Port: origin.Port}
+			}
+			return
+		}
+	}
+	t.err = errNoResponse
+}
+
+// natDiscovery is the outcome of the RFC 5780 mapping and filtering tests.
+type natDiscovery struct {
+	local *net.UDPAddr
+	// other is the server's alternate address, from OTHER-ADDRESS.
+	other     *net.UDPAddr
+	tests     []*natTest
+	mapping   string
+	filtering string
+}
+
+// sameAddr reports whether a and b are the same IP and port.
+func sameAddr(a, b *net.UDPAddr) bool {
+	return a != nil && b != nil && a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+// discoverMapping runs the mapping behavior tests of RFC 5780, section 4.3,
+// on one socket: the mapped address seen by the primary address is compared
+// with those seen by the alternate IP, and then by the alternate IP and
+// port.
+func discoverMapping(cfg config, server *net.UDPAddr, d *natDiscovery) error {
+	s, err := listenNAT(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	first := &natTest{name: "Mapping test I", to: server}
+	s.run(first)
+	d.tests = append(d.tests, first)
+	if first.err != nil {
+		return fmt.Errorf("%s: %w", first.name, first.err)
+	}
+
+	if d.other = first.other; d.other == nil {
+		return errors.New("server does not advertise OTHER-ADDRESS; NAT behavior discovery needs an RFC 5780 server with two addresses")
+	}
+
+	_, port := addrIPPort(s.conn.LocalAddr())
+	d.local = &net.UDPAddr{IP: currentLocalIP(s.d, server), Port: port}
+	if sameAddr(first.mapped, d.local) {
+		d.mapping = "No NAT (Endpoint-Independent Mapping)"
+		return nil
+	}
+
+	second := &natTest{name: "Mapping test II", to: &net.UDPAddr{IP: d.other.IP, Port: server.Port}}
+	s.run(second)
+	d.tests = append(d.tests, second)
+	if second.err != nil {
+		return fmt.Errorf("%s: %w", second.name, second.err)
+	}
+	if sameAddr(second.mapped, first.mapped) {
+		d.mapping = "Endpoint-Independent Mapping"
+		return nil
+	}
+
+	third := &natTest{name: "Mapping test III", to: d.other}
+	s.run(third)
+	d.tests = append(d.tests, third)
+	if third.err != nil {
+		return fmt.Errorf("%s: %w", third.name, third.err)
+	}
+	if sameAddr(third.mapped, second.mapped) {
+		d.mapping = "Address-Dependent Mapping"
+	} else {
+		d.mapping = "Address and Port-Dependent Mapping"
+	}
+	return nil
+}
+
+// discoverFiltering runs the filtering behavior tests of RFC 5780, section
+// 4.4, on a fresh socket whose only binding is towards the primary address:
+// the server is asked to answer from its alternate IP and port, and then
+// from its alternate port only. With all set, the second test is run even
+// when the first one already settles the classification.
+func discoverFiltering(cfg config, server *net.UDPAddr, d *natDiscovery, all bool) error {
+	s, err := listenNAT(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	first := &natTest{name: "Filtering test I", to: server}
+	s.run(first)
+	d.tests = append(d.tests, first)
+	if first.err != nil {
+		return fmt.Errorf("%s: %w", first.name, first.err)
+	}
+
+	changed := &natTest{name: "Filtering test II", to: server, change: changeIP | changePort}
+	s.run(changed)
+	d.tests = append(d.tests, changed)
+
+	var portOnly *natTest
+	if all || changed.err != nil {
+		portOnly = &natTest{name: "Filtering test III", to: server, change: changePort}
+		s.run(portOnly)
+		d.tests = append(d.tests, portOnly)
+	}
+
+	d.filtering, err = classifyFiltering(server, changed, portOnly)
+	return err
+}
+
+// classifyFiltering derives the filtering behavior from whether responses
+// sent from the server's alternate IP and port (changed) and from its
+// alternate port only (portOnly) got through. portOnly may be nil when
+// changed got through.
+func classifyFiltering(server *net.UDPAddr, changed, portOnly *natTest) (string, error) {
+	for _, t := range []*natTest{changed, portOnly} {
+		if t == nil {
+			continue
+		}
+		if t.err != nil && !errors.Is(t.err, errNoResponse) {
+			return "", fmt.Errorf("%s: %w", t.name, t.err)
+		}
+		if t.err == nil && t.from.Port == server.Port {
+			return "", errors.New("server ignored CHANGE-REQUEST")
+		}
+	}
+
+	switch {
+	case changed.err == nil:
+		return "Endpoint-Independent Filtering", nil
+	case portOnly.err == nil:
+		return "Address-Dependent Filtering", nil
+	default:
+		return "Address and Port-Dependent Filtering", nil
+	}
+}
+
+// filteringAdvice says what a filtering behavior means for peer-to-peer
+// connectivity.
+var filteringAdvice = map[string]string{
+	"Endpoint-Independent Filtering":       "any peer that learns your mapped address can reach you, so direct connections should work without TURN.",
+	"Address-Dependent Filtering":          "a peer can reach you once you have sent to its IP address; hole punching works when both sides send.",
+	"Address and Port-Dependent Filtering": "a peer can reach you only from the exact address and port you sent to; direct connections depend on the peer's NAT and may need TURN.",
+}
+
+// runNATFiltering asks the server to answer from its alternate address and
+// port through CHANGE-REQUEST, reports which responses arrived and
+// classifies the NAT's filtering behavior.
+func runNATFiltering(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-nat-filtering needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("NAT filtering test via %s\n\n", server)
+	printServerCapabilities(cfg, server)
+	d := &natDiscovery{}
+	err = discoverFiltering(cfg, server, d, true)
+	printNATTests(d.tests)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nFiltering: %s\n", d.filtering)
+	fmt.Printf("This means %s\n", filteringAdvice[d.filtering])
+	return nil
+}
+
+// classifyMapping derives the mapping behavior from the mapped addresses
+// that several server addresses saw from one socket. Telling address-
+// dependent from address and port-dependent mapping needs two ports on one
+// server IP.
+func classifyMapping(tests []*natTest, local *net.UDPAddr) string {
+	var answered []*natTest
+	for _, t := range tests {
+		if t.err == nil {
+			answered = append(answered, t)
+		}
+	}
+	if len(answered) > 0 && sameAddr(answered[0].mapped, local) {
+		return "No NAT (Endpoint-Independent Mapping)"
+	}
+	if len(answered) < 2 {
+		return "unknown (fewer than two server addresses answered)"
+	}
+
+	independent := true
+	portPairs, portDependent := 0, false
+	for i, a := range answered {
+		for _, b := range answered[i+1:] {
+			if !sameAddr(a.mapped, b.mapped) {
+				independent = false
+			}
+			if a.to.IP.Equal(b.to.IP) && a.to.Port != b.to.Port {
+				portPairs++
+				if !sameAddr(a.mapped, b.mapped) {
+					portDependent = true
+				}
+			}
+		}
+	}
+	switch {
+	case independent:
+		return "Endpoint-Independent Mapping"
+	case portDependent:
+		return "Address and Port-Dependent Mapping"
+	case portPairs > 0:
+		return "Address-Dependent Mapping"
+	default:
+		return "Address-Dependent or Address and Port-Dependent Mapping (add a second port on one server to tell them apart)"
+	}
+}
+
+// runNATMapping sends Binding requests from one socket to several server
+// addresses and compares the mapped addresses they report. The addresses are
+// the comma-separated -host list or, for a single host, its primary address,
+// its alternate IP and its alternate IP and port from OTHER-ADDRESS.
+func runNATMapping(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-nat-mapping needs -transport udp")
+	}
+	var targets []*net.UDPAddr
+	for _, host := range strings.Split(cfg.stunHost, ",") {
+		server, err := resolveNATServer(strings.TrimSpace(host), cfg.ipVersion)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, server)
+	}
+	if len(targets) == 1 {
+		printServerCapabilities(cfg, targets[0])
+	}
+
+	s, err := listenNAT(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var tests []*natTest
+	for i := 0; i < len(targets); i++ {
+		to := targets[i]
+		t := &natTest{name: fmt.Sprintf("Server %d", i+1), to: to}
+		s.run(t)
+		tests = append(tests, t)
+
+		if len(targets) == 1 {
+			if t.other == nil {
+				return errors.New("server does not advertise OTHER-ADDRESS; pass several addresses in -host instead")
+			}
+			targets = append(targets, &net.UDPAddr{IP: t.other.IP, Port: to.Port}, t.other)
+		}
+	}
+
+	_, port := addrIPPort(s.conn.LocalAddr())
+	local := &net.UDPAddr{IP: currentLocalIP(s.d, targets[0]), Port: port}
+	fmt.Printf("NAT mapping test from local address %s\n\n", local)
+	printNATTests(tests)
+	fmt.Printf("\nMapping: %s\n", classifyMapping(tests, local))
+	return nil
+}
+
+// resolveNATServer resolves the primary address of the STUN server, of the
+// given IP version if it is not 0.
+func resolveNATServer(host string, version int) (*net.UDPAddr, error) {
+	u, err := stun.ParseURI("stun:" + host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	addr, err := resolveFamily(net.JoinHostPort(u.Host, strconv.Itoa(u.Port)), version)
+	if err != nil {
+		return nil, err
+	}
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve STUN server: %w", err)
+	}
+	return server, nil
+}
+
+// runNATCheck classifies the NAT's mapping and filtering behavior following
+// RFC 5780.
+func runNATCheck(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-nat-check needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+	d := &natDiscovery{}
+	fmt.Printf("NAT behavior discovery via %s\n\n", server)
+	printServerCapabilities(cfg, server)
+
+	mapErr := discoverMapping(cfg, server, d)
+	filterErr := discoverFiltering(cfg, server, d, false)
+	printNATTests(d.tests)
+
+	fmt.Println()
+	if mapErr != nil {
+		fmt.Printf("Mapping:   unknown (%v)\n", mapErr)
+	} else {
+		fmt.Printf("Mapping:   %s\n", d.mapping)
+	}
+	if filterErr != nil {
+		fmt.Printf("Filtering: unknown (%v)\n", filterErr)
+	} else {
+		fmt.Printf("Filtering: %s\n", d.filtering)
+	}
+	fmt.Printf("Hairpin:   %s\n", checkHairpin(cfg, server))
+	if mapErr == nil && filterErr == nil {
+		fmt.Printf("\nResult: %s, %s\n", d.mapping, d.filtering)
+	}
+	return nil
+}
+
+func printNATTests(tests []*natTest) {
+	for _, t := range tests {
+		change := ""
+		switch t.change {
+		case changeIP | changePort:
+			change = " (change IP and port)"
+		case changePort:
+			change = " (change port)"
+		case changeIP:
+			change = " (change IP)"
+		}
+		if t.err != nil {
+			fmt.Printf("%-18s to %s%s: %v\n", t.name, t.to, change, t.err)
+			continue
+		}
+		fmt.Printf("%-18s to %s%s: mapped %s, from %s, %d μs\n", t.name, t.to, change, t.mapped, t.from, t.rtt.Microseconds())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func udpAddr(s string) *net.UDPAddr {
+	a, err := net.ResolveUDPAddr("udp", s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// mappingTest is a mapping test sent to to that saw mapped, or got no
+// response when mapped is empty.
+func mappingTest(to, mapped string) *natTest {
+	t := &natTest{to: udpAddr(to)}
+	if mapped == "" {
+		t.err = errNoResponse
+		return t
+	}
+	t.mapped = udpAddr(mapped)
+	return t
+}
+
+func TestClassifyMapping(t *testing.T) {
+	local := udpAddr("192.168.1.10:40000")
+	tests := []struct {
+		name  string
+		tests []*natTest
+		want  string
+	}{
+		{
+			"no NAT",
+			[]*natTest{mappingTest("198.51.100.1:3478", "192.168.1.10:40000")},
+			"No NAT (Endpoint-Independent Mapping)",
+		},
+		{
+			"one answer",
+			[]*natTest{mappingTest("198.51.100.1:3478", "203.0.113.5:6000"), mappingTest("198.51.100.2:3479", "")},
+			"unknown (fewer than two server addresses answered)",
+		},
+		{
+			"endpoint-independent",
+			[]*natTest{
+				mappingTest("198.51.100.1:3478", "203.0.113.5:6000"),
+				mappingTest("198.51.100.2:3478", "203.0.113.5:6000"),
+				mappingTest("198.51.100.2:3479", "203.0.113.5:6000"),
+			},
+			"Endpoint-Independent Mapping",
+		},
+		{
+			"address-dependent",
+			[]*natTest{
+				mappingTest("198.51.100.1:3478", "203.0.113.5:6000"),
+				mappingTest("198.51.100.2:3478", "203.0.113.5:6001"),
+				mappingTest("198.51.100.2:3479", "203.0.113.5:6001"),
+			},
+			"Address-Dependent Mapping",
+		},
+		{
+			"address and port-dependent",
+			[]*natTest{
+				mappingTest("198.51.100.1:3478", "203.0.113.5:6000"),
+				mappingTest("198.51.100.2:3478", "203.0.113.5:6001"),
+				mappingTest("198.51.100.2:3479", "203.0.113.5:6002"),
+			},
+			"Address and Port-Dependent Mapping",
+		},
+		{
+			"no second port",
+			[]*natTest{
+				mappingTest("198.51.100.1:3478", "203.0.113.5:6000"),
+				mappingTest("198.51.100.2:3478", "203.0.113.5:6001"),
+			},
+			"Address-Dependent or Address and Port-Dependent Mapping (add a second port on one server to tell them apart)",
+		},
+	}
+	for _, tt := range tests {
+		if got := classifyMapping(tt.tests, local); got != tt.want {
+			t.Errorf("%s: classifyMapping() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// filteringTest is a filtering test whose response came from from, or that
+// failed with err.
+func filteringTest(from string, err error) *natTest {
+	t := &natTest{name: "Filtering test", err: err}
+	if err == nil {
+		t.from = udpAddr(from)
+	}
+	return t
+}
+
+func TestClassifyFiltering(t *testing.T) {
+	server := udpAddr("198.51.100.1:3478")
+	tests := []struct {
+		name              string
+		changed, portOnly *natTest
+		want              string
+		wantErr           bool
+	}{
+		{"endpoint-independent", filteringTest("198.51.100.2:3479", nil), nil, "Endpoint-Independent Filtering", false},
+		{"endpoint-independent, both run", filteringTest("198.51.100.2:3479", nil), filteringTest("198.51.100.1:3479", nil), "Endpoint-Independent Filtering", false},
+		{"address-dependent", filteringTest("", errNoResponse), filteringTest("198.51.100.1:3479", nil), "Address-Dependent Filtering", false},
+		{"address and port-dependent", filteringTest("", errNoResponse), filteringTest("", errNoResponse), "Address and Port-Dependent Filtering", false},
+		{"CHANGE-REQUEST ignored", filteringTest("198.51.100.1:3478", nil), nil, "", true},
+		{"CHANGE-REQUEST ignored on port", filteringTest("", errNoResponse), filteringTest("198.51.100.1:3478", nil), "", true},
+		{"error response", filteringTest("", errors.New("Binding failed: 420 Unknown Attribute")), nil, "", true},
+	}
+	for _, tt := range tests {
+		got, err := classifyFiltering(server, tt.changed, tt.portOnly)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("%s: classifyFiltering() = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// omissionPercentiles are the rows of the coordinated omission table.
+var omissionPercentiles = []float64{50, 90, 99, 99.9, 100}
+
+// correctsOmission reports whether requests in the run were due on a fixed
+// schedule, so that latencies can be corrected for coordinated omission.
+// Only open-loop runs have one: with -interval the pause starts when a
+// response arrives, so no request is ever late.
+func correctsOmission(cfg config) bool {
+	return cfg.rate > 0 || cfg.ramp != nil
+}
+
+// omissionTimes returns the sorted successful RTTs of an open-loop run
+// twice, without and with correction for coordinated omission. The run
+// already times each request from when it was due, so the uncorrected
+// times are measured from when it was actually sent instead.
+func omissionTimes(results []result) (uncorrected, corrected []int64) {
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		uncorrected = append(uncorrected, r.time-r.sendLag.Microseconds())
+		corrected = append(corrected, r.time)
+	}
+	sort.Slice(uncorrected, func(i, j int) bool { return uncorrected[i] < uncorrected[j] })
+	sort.Slice(corrected, func(i, j int) bool { return corrected[i] < corrected[j] })
+	return uncorrected, corrected
+}
+
+// printOmission shows the uncorrected and corrected distributions of an
+// open-loop run side by side.
+func printOmission(results []result) {
+	uncorrected, corrected := omissionTimes(results)
+	if len(uncorrected) == 0 {
+		return
+	}
+
+	fmt.Println("\nCoordinated omission: corrected times run from when each request was due, uncorrected from when it was sent")
+	fmt.Println("┌───────┬──────────────────┬────────────────┐")
+	fmt.Printf("│ %%tile │ Uncorrected (μs) │ Corrected (μs) │\n")
+	fmt.Println("├───────┼──────────────────┼────────────────┤")
+	for _, p := range omissionPercentiles {
+		fmt.Printf("│ %-5s │ %16d │ %14d │\n", percentileCell(p), percentile(uncorrected, p), percentile(corrected, p))
+	}
+	fmt.Println("└───────┴──────────────────┴────────────────┘")
+}
+
+// omissionReport returns the uncorrected and corrected percentiles of an
+// open-loop run for the JSON report.
+func omissionReport(results []result, percentiles []float64) (uncorrected, corrected []jsonPercentile) {
+	u, c := omissionTimes(results)
+	if len(u) == 0 {
+		return nil, nil
+	}
+	for _, p := range percentiles {
+		uncorrected = append(uncorrected, jsonPercentile{Percentile: p, Time: percentile(u, p)})
+		corrected = append(corrected, jsonPercentile{Percentile: p, Time: percentile(c, p)})
+	}
+	return uncorrected, corrected
+}
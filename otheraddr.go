@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/pion/stun"
+)
+
+// otherAddress returns the server's secondary address as advertised by
+// OTHER-ADDRESS (RFC 5780) or, for older servers, CHANGED-ADDRESS (RFC 3489).
+func otherAddress(m *stun.Message) *net.UDPAddr {
+	for _, t := range []stun.AttrType{stun.AttrOtherAddress, stun.AttrChangedAddress} {
+		var a stun.MappedAddress
+		if err := a.GetFromAs(m, t); err == nil {
+			return &net.UDPAddr{IP: a.IP, Port: a.Port}
+		}
+	}
+	return nil
+}
+
+func discoveredOtherAddress(results []result) *net.UDPAddr {
+	for _, r := range results {
+		if r.other != nil {
+			return r.other
+		}
+	}
+	return nil
+}
+
+// measureOtherAddress runs the same measurement against the secondary address
+// discovered in the primary results and prints its summary.
+func measureOtherAddress(cfg config, primary []result) error {
+	other := discoveredOtherAddress(primary)
+	if other == nil {
+		fmt.Println("\nServer did not advertise OTHER-ADDRESS or CHANGED-ADDRESS")
+		return nil
+	}
+
+	fmt.Printf("\nMeasuring secondary address %s\n", other)
+	results, err := runSTUNRequests(cfg, other.String())
+	if err != nil {
+		return fmt.Errorf("secondary address: %w", err)
+	}
+
+	printResults(cfg, results)
+	printASCIIHistogram(cfg, results)
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types below are the subset of the OTLP/HTTP JSON encoding needed to
+// export one histogram and two counters. 64-bit integers are strings, as
+// the protobuf JSON mapping requires.
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpHistogramPoint struct {
+	StartTime      string    `json:"startTimeUnixNano"`
+	Time           string    `json:"timeUnixNano"`
+	Count          string    `json:"count"`
+	Sum            float64   `json:"sum"`
+	BucketCounts   []string  `json:"bucketCounts"`
+	ExplicitBounds []float64 `json:"explicitBounds"`
+	Min            *float64  `json:"min,omitempty"`
+	Max            *float64  `json:"max,omitempty"`
+}
+
+type otlpNumberPoint struct {
+	StartTime string `json:"startTimeUnixNano"`
+	Time      string `json:"timeUnixNano"`
+	AsInt     string `json:"asInt"`
+}
+
+type otlpHistogram struct {
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Unit        string         `json:"unit"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpCumulative = 2
+
+func otlpAttr(key, value string) otlpAttribute {
+	var a otlpAttribute
+	a.Key = key
+	a.Value.StringValue = value
+	return a
+}
+
+func otlpCounter(name, description string, value int, start, end string) otlpMetric {
+	m := otlpMetric{Name: name, Description: description, Unit: "1"}
+	m.Sum = &otlpSum{otlpCumulative, true, []otlpNumberPoint{{StartTime: start, Time: end, AsInt: strconv.Itoa(value)}}}
+	return m
+}
+
+// otlpPayload builds an OTLP metrics export request for a finished run.
+func otlpPayload(cfg config, results []result) map[string]any {
+	hostname, _ := os.Hostname()
+	resource := []otlpAttribute{
+		otlpAttr("service.name", "stun-timing"),
+		otlpAttr("host.name", hostname),
+		otlpAttr("server.address", cfg.stunHost),
+		otlpAttr("network.transport", cfg.transport),
+	}
+
+	start := time.Now()
+	if len(results) > 0 {
+		start = results[0].start
+	}
+	startNano := strconv.FormatInt(start.UnixNano(), 10)
+	endNano := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	counts := make([]int, len(rttBuckets)+1)
+	var sum float64
+	var minRTT, maxRTT *float64
+	var failed int
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			continue
+		}
+		rtt := float64(r.time) / 1e6
+		sum += rtt
+		bucket := len(rttBuckets)
+		for i, le := range rttBuckets {
+			if rtt <= le {
+				bucket = i
+				break
+			}
+		}
+		counts[bucket]++
+		if minRTT == nil || rtt < *minRTT {
+			minRTT = &rtt
+		}
+		if maxRTT == nil || rtt > *maxRTT {
+			maxRTT = &rtt
+		}
+	}
+
+	bucketCounts := make([]string, len(counts))
+	for i, c := range counts {
+		bucketCounts[i] = strconv.Itoa(c)
+	}
+	rtt := otlpMetric{Name: "stun.rtt", Description: "Round-trip time of successful STUN binding requests.", Unit: "s"}
+	rtt.Histogram = &otlpHistogram{otlpCumulative, []otlpHistogramPoint{{
+		StartTime:      startNano,
+		Time:           endNano,
+		Count:          strconv.Itoa(len(results) - failed),
+		Sum:            sum,
+		BucketCounts:   bucketCounts,
+		ExplicitBounds: rttBuckets,
+		Min:            minRTT,
+		Max:            maxRTT,
+	}}}
+
+	metrics := []otlpMetric{
+		rtt,
+		otlpCounter("stun.requests", "STUN binding requests sent.", len(results), startNano, endNano),
+		otlpCounter("stun.failures", "STUN binding requests that failed or timed out.", failed, startNano, endNano),
+	}
+
+	return map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": resource},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": "stun-timing"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
+
+// otlpMetricsURL resolves the collector endpoint the way OTel SDKs do: a
+// bare base URL gets the standard /v1/metrics path.
+func otlpMetricsURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP endpoint %q (want e.g. http://localhost:4318)", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	return u.String(), nil
+}
+
+// exportOTLP sends the run's metrics to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding.
+func exportOTLP(cfg config, results []result) error {
+	target, err := otlpMetricsURL(cfg.otlpEndpoint)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(otlpPayload(cfg, results))
+	if err != nil {
+		return fmt.Errorf("failed to encode OTLP metrics: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to export OTLP metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("OTLP export failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	fmt.Fprintf(cfg.logOutput(), "Exported metrics for %d requests to %s\n", len(results), target)
+	return nil
+}
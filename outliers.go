@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// outlierThreshold is the modified z-score above which an RTT counts as an
+// outlier, as recommended by Iglewicz and Hoaglin.
+const outlierThreshold = 3.5
+
+// outlierListLimit is how many outliers printOutliers lists one by one.
+const outlierListLimit = 20
+
+// findOutliers returns the successful results whose RTT lies far from the
+// median, measured in median absolute deviations. Unlike the standard
+// deviation, the MAD is not itself inflated by the outliers it looks for.
+// It returns nothing when more than half the RTTs are identical.
+func findOutliers(results []result) []result {
+	times := sortedSuccessfulTimes(results)
+	if len(times) < 3 {
+		return nil
+	}
+	median := percentile(times, 50)
+	deviations := make([]int64, len(times))
+	for i, t := range times {
+		deviations[i] = absInt64(t - median)
+	}
+	sort.Slice(deviations, func(i, j int) bool { return deviations[i] < deviations[j] })
+	mad := percentile(deviations, 50)
+	if mad == 0 {
+		return nil
+	}
+
+	var outliers []result
+	for _, r := range results {
+		// 0.6745 scales the MAD to the standard deviation of a normal
+		// distribution.
+		if r.err == nil && math.Abs(0.6745*float64(r.time-median)/float64(mad)) > outlierThreshold {
+			outliers = append(outliers, r)
+		}
+	}
+	return outliers
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// printOutliers reports how many RTTs were outliers and when they occurred,
+// and with trim compares the run with and without them.
+func printOutliers(results []result, trim bool) {
+	outliers := findOutliers(results)
+	successful := len(sortedSuccessfulTimes(results))
+	fmt.Printf("\nOutliers (modified z-score above %g): %d of %d\n", outlierThreshold, len(outliers), successful)
+	for i, r := range outliers {
+		if i == outlierListLimit {
+			fmt.Printf("  ... and %d more\n", len(outliers)-outlierListLimit)
+			break
+		}
+		fmt.Printf("  request #%d at %s: %d μs\n", r.index, r.start.Format("15:04:05.000000"), r.time)
+	}
+	if !trim || len(outliers) == 0 {
+		return
+	}
+
+	flagged := make(map[int]bool, len(outliers))
+	for _, r := range outliers {
+		flagged[r.index] = true
+	}
+	var trimmed []result
+	for _, r := range results {
+		if !flagged[r.index] {
+			trimmed = append(trimmed, r)
+		}
+	}
+	fmt.Println()
+	printComparison([]comparisonRow{
+		{label: "All requests", results: results},
+		{label: "Without outliers", results: trimmed},
+	})
+}
+
+type jsonOutlier struct {
+	Time  time.Time `json:"time"`
+	Index int       `json:"index"`
+	RTT   int64     `json:"time_us"`
+}
+
+func outlierReport(results []result) []jsonOutlier {
+	var report []jsonOutlier
+	for _, r := range findOutliers(results) {
+		report = append(report, jsonOutlier{Time: r.start, Index: r.index, RTT: r.time})
+	}
+	return report
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFindOutliers(t *testing.T) {
+	timeout := errors.New("timeout")
+	tests := []struct {
+		name  string
+		times []int64
+		// failed are the indices of requests that failed.
+		failed []int
+		want   []int
+	}{
+		{"too few", []int64{100, 5000}, nil, nil},
+		{"none", []int64{98, 99, 100, 101, 102, 103}, nil, nil},
+		{"slow", []int64{98, 99, 100, 101, 102, 103, 500}, nil, []int{6}},
+		{"slow and fast", []int64{10, 98, 99, 100, 101, 102, 103, 104, 500}, nil, []int{0, 8}},
+		{"failures ignored", []int64{0, 98, 99, 100, 101, 102, 103, 500}, []int{0}, []int{7}},
+		{"mostly identical", []int64{100, 100, 100, 100, 9000}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make([]result, len(tt.times))
+			for i, v := range tt.times {
+				results[i] = result{index: i, time: v}
+				if slices.Contains(tt.failed, i) {
+					results[i].err = timeout
+				}
+			}
+			var got []int
+			for _, r := range findOutliers(results) {
+				got = append(got, r.index)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("outliers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
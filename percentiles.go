@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultPercentiles are reported when no percentile list is given.
+var defaultPercentiles = []float64{0, 25, 50, 75, 100}
+
+// parsePercentiles parses a comma-separated list like "50,90,p99,99.9".
+func parsePercentiles(s string) ([]float64, error) {
+	var ps []float64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "p")
+		p, err := strconv.ParseFloat(part, 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q (want 0-100)", part)
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+// percentileLabel formats p as it appears in the results table, e.g. p99.9.
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// percentileCell centers p's label in the five-character %tile column.
+func percentileCell(p float64) string {
+	label := percentileLabel(p)
+	return strings.Repeat(" ", (5-len(label))/2) + label
+}
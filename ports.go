@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// classifyPortAllocation guesses the NAT's external port allocation strategy
+// from mapped ports observed on consecutive fresh sockets.
+func classifyPortAllocation(local, mapped []int) string {
+	if len(mapped) < 2 {
+		return "unknown (not enough samples)"
+	}
+
+	preserved := 0
+	for i := range mapped {
+		if mapped[i] == local[i] {
+			preserved++
+		}
+	}
+	if preserved*10 >= len(mapped)*9 {
+		return "preserved (external port matches local port)"
+	}
+
+	small := 0
+	for i := 1; i < len(mapped); i++ {
+		if d := mapped[i] - mapped[i-1]; d >= 1 && d <= 10 {
+			small++
+		}
+	}
+	if small*10 >= (len(mapped)-1)*9 {
+		return "sequential"
+	}
+
+	return "random"
+}
+
+// portPredictWindow is how far off a predicted port may be and still count
+// as a hit; hole punching typically sprays a small range around the guess.
+const portPredictWindow = 10
+
+// portPredictability summarizes how well the next mapped port can be
+// guessed from the previous ones.
+type portPredictability struct {
+	// preserved is the share of mapped ports equal to the local port.
+	preserved float64
+	// stride is the most common difference between consecutive mapped
+	// ports, and strideShare the share of differences equal to it.
+	stride      int
+	strideShare float64
+	// hitRate is the share of mapped ports within portPredictWindow of the
+	// previous port plus stride.
+	hitRate float64
+}
+
+func predictPorts(local, mapped []int) portPredictability {
+	var p portPredictability
+	if len(mapped) == 0 {
+		return p
+	}
+	preserved := 0
+	for i := range mapped {
+		if mapped[i] == local[i] {
+			preserved++
+		}
+	}
+	p.preserved = float64(preserved) / float64(len(mapped))
+	if len(mapped) < 2 {
+		return p
+	}
+
+	counts := make(map[int]int)
+	for i := 1; i < len(mapped); i++ {
+		counts[mapped[i]-mapped[i-1]]++
+	}
+	// Ties go to the smallest stride, so that the result does not depend on
+	// map order.
+	for d, n := range counts {
+		best := counts[p.stride]
+		if n > best || (n == best && (abs(d) < abs(p.stride) || (abs(d) == abs(p.stride) && d > p.stride))) {
+			p.stride = d
+		}
+	}
+	pairs := float64(len(mapped) - 1)
+	p.strideShare = float64(counts[p.stride]) / pairs
+
+	hits := 0
+	for i := 1; i < len(mapped); i++ {
+		if abs(mapped[i]-(mapped[i-1]+p.stride)) <= portPredictWindow {
+			hits++
+		}
+	}
+	p.hitRate = float64(hits) / pairs
+	return p
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func printPortDistribution(results []result) {
+	var local, mapped []int
+	for _, r := range results {
+		if r.err != nil || r.mapped == nil {
+			continue
+		}
+		local = append(local, r.port)
+		mapped = append(mapped, r.mapped.Port)
+	}
+	printPortAnalysis(local, mapped)
+}
+
+// printPortAnalysis reports the mapped ports seen for the given local ports,
+// in the order the sockets were opened.
+func printPortAnalysis(local, mapped []int) {
+	if len(mapped) == 0 {
+		fmt.Println("\nNo mapped ports observed")
+		return
+	}
+
+	unique := make(map[int]bool)
+	for _, p := range mapped {
+		unique[p] = true
+	}
+
+	var deltas []string
+	for i := 1; i < len(mapped) && i <= 10; i++ {
+		deltas = append(deltas, fmt.Sprintf("%+d", mapped[i]-mapped[i-1]))
+	}
+
+	sorted := append([]int(nil), mapped...)
+	sort.Ints(sorted)
+
+	fmt.Println("\nMapped port distribution:")
+	fmt.Printf("Samples: %d, unique ports: %d\n", len(mapped), len(unique))
+	fmt.Printf("Range: %d - %d\n", sorted[0], sorted[len(sorted)-1])
+	fmt.Printf("First deltas: %s\n", strings.Join(deltas, " "))
+	fmt.Printf("Allocation: %s\n", classifyPortAllocation(local, mapped))
+
+	p := predictPorts(local, mapped)
+	fmt.Println("\nPredictability:")
+	fmt.Printf("  Preserved ports:   %.0f%%\n", p.preserved*100)
+	if len(mapped) > 1 {
+		fmt.Printf("  Most common delta: %+d (%.0f%% of consecutive pairs)\n", p.stride, p.strideShare*100)
+		fmt.Printf("  Next port within ±%d of the previous port %+d: %.0f%%\n", portPredictWindow, p.stride, p.hitRate*100)
+	}
+
+	ports := make([]int64, len(sorted))
+	for i, p := range sorted {
+		ports[i] = int64(p)
+	}
+	buckets := computeHistogram(ports, 10)
+	maxCount := 0
+	for _, b := range buckets {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	fmt.Println()
+	for _, b := range buckets {
+		bar := strings.Repeat("█", b.Count*40/maxCount)
+		fmt.Printf("%5d - %5d | %-40s | %d\n", b.Start, b.End, bar, b.Count)
+	}
+}
+
+// runPortSockets opens cfg.portSockets sockets at once, keeping all of them
+// open until the end, and analyzes the mapped ports the server sees for them.
+// Unlike -port-study, no local port can be reused between samples.
+func runPortSockets(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-port-sockets needs -transport udp")
+	}
+	server, err := resolveNATServer(cfg.stunHost, cfg.ipVersion)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cfg.logOutput(), "Opening %d sockets to %s...\n", cfg.portSockets, server)
+	bar := cfg.progressBar(cfg.portSockets)
+	var local, mapped []int
+	failed := 0
+	for i := 0; i < cfg.portSockets; i++ {
+		s, err := listenNAT(cfg)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		t := &natTest{to: server}
+		s.run(t)
+		bar.Add(1)
+		if t.err != nil {
+			failed++
+			continue
+		}
+		_, port := addrIPPort(s.conn.LocalAddr())
+		local = append(local, port)
+		mapped = append(mapped, t.mapped.Port)
+	}
+	fmt.Fprintln(cfg.logOutput())
+
+	if failed > 0 {
+		fmt.Printf("Sockets without a response: %d\n", failed)
+	}
+	printPortAnalysis(local, mapped)
+	return nil
+}
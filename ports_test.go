@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestClassifyPortAllocation(t *testing.T) {
+	tests := []struct {
+		name          string
+		local, mapped []int
+		want          string
+	}{
+		{"one sample", []int{40000}, []int{40000}, "unknown (not enough samples)"},
+		{"preserved", []int{40000, 40100, 40200}, []int{40000, 40100, 40200}, "preserved (external port matches local port)"},
+		{"mostly preserved", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 99}, "preserved (external port matches local port)"},
+		{"sequential", []int{40000, 40100, 40200, 40300}, []int{1024, 1025, 1027, 1030}, "sequential"},
+		{"random", []int{40000, 40100, 40200, 40300}, []int{1024, 61000, 2048, 33333}, "random"},
+		{"descending", []int{40000, 40100, 40200}, []int{1030, 1029, 1028}, "random"},
+	}
+	for _, tt := range tests {
+		if got := classifyPortAllocation(tt.local, tt.mapped); got != tt.want {
+			t.Errorf("%s: classifyPortAllocation() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rampSteps is how many slices of the ramp the report breaks the results
+// into.
+const rampSteps = 10
+
+// rampProfile is an open-loop load whose rate grows linearly from from to
+// to requests per second over over.
+type rampProfile struct {
+	from, to float64
+	over     time.Duration
+}
+
+// parseRamp parses a ramp like "10:1000:60s".
+func parseRamp(s string) (*rampProfile, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid ramp %q (want from:to:duration, e.g. 10:1000:60s)", s)
+	}
+	from, err1 := strconv.ParseFloat(parts[0], 64)
+	to, err2 := strconv.ParseFloat(parts[1], 64)
+	over, err3 := time.ParseDuration(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil || from <= 0 || to <= 0 || over <= 0 {
+		return nil, fmt.Errorf("invalid ramp %q (want from:to:duration, e.g. 10:1000:60s)", s)
+	}
+	return &rampProfile{from: from, to: to, over: over}, nil
+}
+
+func (r *rampProfile) String() string {
+	return fmt.Sprintf("%g to %g requests/s over %s", r.from, r.to, r.over)
+}
+
+// slope is how fast the rate grows, in requests per second per second.
+func (r *rampProfile) slope() float64 {
+	return (r.to - r.from) / r.over.Seconds()
+}
+
+// total is how many requests the ramp sends.
+func (r *rampProfile) total() int {
+	return int((r.from + r.to) / 2 * r.over.Seconds())
+}
+
+// rateAt is the offered rate t into the ramp.
+func (r *rampProfile) rateAt(t time.Duration) float64 {
+	return r.from + r.slope()*t.Seconds()
+}
+
+// offset is when request i is due relative to the start of the ramp: the
+// time at which the integral of the rate reaches i.
+func (r *rampProfile) offset(i int) time.Duration {
+	a, b := r.slope()/2, r.from
+	var t float64
+	if math.Abs(a) < 1e-9 {
+		t = float64(i) / b
+	} else {
+		t = (-b + math.Sqrt(b*b+4*a*float64(i))) / (2 * a)
+	}
+	return time.Duration(t * float64(time.Second))
+}
+
+// printRamp breaks the results of a ramp into rampSteps slices of equal
+// duration and reports the loss and latency at each slice's offered rate,
+// marking the first slice where either degrades.
+func printRamp(results []result, r *rampProfile) {
+	if len(results) == 0 {
+		return
+	}
+	begin := results[0].start
+	step := r.over / rampSteps
+	slices := make([][]result, rampSteps)
+	for _, res := range results {
+		i := min(int(res.start.Sub(begin)/step), rampSteps-1)
+		slices[i] = append(slices[i], res)
+	}
+
+	fmt.Printf("\nRamp: %s\n", r)
+	fmt.Println("┌────────────────┬────────┬────────┬───────────┬───────────┐")
+	fmt.Println("│ Offered (r/s)  │  Sent  │ Loss % │ p50 (μs)  │ p95 (μs)  │")
+	fmt.Println("├────────────────┼────────┼────────┼───────────┼───────────┤")
+	var baseline50, baseline95 int64
+	knee := -1.0
+	for i, slice := range slices {
+		rate := r.rateAt(step*time.Duration(i) + step/2)
+		times := sortedSuccessfulTimes(slice)
+		loss := 0.0
+		if len(slice) > 0 {
+			loss = float64(len(slice)-len(times)) / float64(len(slice)) * 100
+		}
+		if len(times) == 0 {
+			fmt.Printf("│ %14.0f │ %6d │ %6.1f │ %9s │ %9s │\n", rate, len(slice), loss, "-", "-")
+			if knee < 0 && len(slice) > 0 {
+				knee = rate
+			}
+			continue
+		}
+		p50, p95 := percentile(times, 50), percentile(times, 95)
+		fmt.Printf("│ %14.0f │ %6d │ %6.1f │ %9d │ %9d │\n", rate, len(slice), loss, p50, p95)
+
+		if baseline50 == 0 {
+			baseline50, baseline95 = p50, p95
+		} else if knee < 0 && (float64(p50) > float64(baseline50)*kneeFactor || float64(p95) > float64(baseline95)*kneeFactor || loss > rampMaxLoss) {
+			knee = rate
+		}
+	}
+	fmt.Println("└────────────────┴────────┴────────┴───────────┴───────────┘")
+
+	if knee >= 0 {
+		fmt.Printf("\nDegradation at about %.0f requests/s (p50 or p95 more than %.1fx the first slice, or loss above %g%%)\n", knee, kneeFactor, rampMaxLoss)
+	} else {
+		fmt.Println("\nNo degradation within the ramp")
+	}
+}
+
+// rampMaxLoss is the loss percentage above which a ramp slice counts as
+// degraded.
+const rampMaxLoss = 1.0
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRampOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		ramp rampProfile
+		i    int
+		want time.Duration
+	}{
+		{"flat start", rampProfile{from: 10, to: 10, over: 2 * time.Second}, 0, 0},
+		{"flat", rampProfile{from: 10, to: 10, over: 2 * time.Second}, 5, 500 * time.Millisecond},
+		// 10 requests per second rising to 30 over 2s sends 10t+5t² by t.
+		{"rising midway", rampProfile{from: 10, to: 30, over: 2 * time.Second}, 15, time.Second},
+		{"rising end", rampProfile{from: 10, to: 30, over: 2 * time.Second}, 40, 2 * time.Second},
+		// 30 falling to 10 sends 30t-5t².
+		{"falling", rampProfile{from: 30, to: 10, over: 2 * time.Second}, 25, time.Second},
+	}
+	for _, tt := range tests {
+		got := tt.ramp.offset(tt.i)
+		if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s: offset(%d) = %s, want %s", tt.name, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestParseRamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    rampProfile
+		total   int
+		wantErr bool
+	}{
+		{in: "10:1000:60s", want: rampProfile{from: 10, to: 1000, over: time.Minute}, total: 30300},
+		{in: "500:50:10s", want: rampProfile{from: 500, to: 50, over: 10 * time.Second}, total: 2750},
+		{in: "0.5:1.5:1m", want: rampProfile{from: 0.5, to: 1.5, over: time.Minute}, total: 60},
+		{in: "10:1000", wantErr: true},
+		{in: "10:1000:60s:1", wantErr: true},
+		{in: "0:1000:60s", wantErr: true},
+		{in: "10:-1:60s", wantErr: true},
+		{in: "10:1000:0s", wantErr: true},
+		{in: "10:1000:60", wantErr: true},
+		{in: "ten:1000:60s", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRamp(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRamp(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || *got != tt.want || got.total() != tt.total {
+			t.Errorf("parseRamp(%q) = %v, %v, want %v with %d requests", tt.in, got, err, &tt.want, tt.total)
+		}
+	}
+}
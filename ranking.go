@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scoreWeights say how much each figure counts towards a server's score.
+type scoreWeights struct {
+	latency, loss, jitter float64
+}
+
+// defaultScoreWeights favor tail latency, then loss, then jitter.
+var defaultScoreWeights = scoreWeights{latency: 0.5, loss: 0.3, jitter: 0.2}
+
+// parseScoreWeights parses weights like "latency=0.5,loss=0.4,jitter=0.1".
+// A figure left out does not count.
+func parseScoreWeights(s string) (scoreWeights, error) {
+	var w scoreWeights
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		v, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil || v < 0 {
+			return w, fmt.Errorf("invalid weight %q (want e.g. latency=0.5,loss=0.4,jitter=0.1)", pair)
+		}
+		switch name {
+		case "latency":
+			w.latency = v
+		case "loss":
+			w.loss = v
+		case "jitter":
+			w.jitter = v
+		default:
+			return w, fmt.Errorf("unknown score weight %q (want latency, loss or jitter)", name)
+		}
+	}
+	if w.latency+w.loss+w.jitter == 0 {
+		return w, errors.New("at least one score weight must be above 0")
+	}
+	return w, nil
+}
+
+func (w scoreWeights) String() string {
+	return fmt.Sprintf("latency=%g,loss=%g,jitter=%g", w.latency, w.loss, w.jitter)
+}
+
+// hostRanking is a measured server with the figures it is ranked by.
+type hostRanking struct {
+	label   string
+	uri     string
+	results []result
+
+	ok            bool
+	p50, p95, p99 int64
+	loss, jitter  float64
+	// score is the weighted sum of the server's p99, loss and jitter, each
+	// as a fraction of the worst among the servers; lower is better.
+	score float64
+}
+
+func newHostRanking(row comparisonRow) hostRanking {
+	h := hostRanking{label: row.label, uri: row.uri, results: row.results, loss: analyzeLoss(row.results).rate()}
+	var ordered []int64
+	for _, r := range row.results {
+		if r.err == nil {
+			ordered = append(ordered, r.time)
+		}
+	}
+	times := sortedSuccessfulTimes(row.results)
+	if len(times) == 0 {
+		return h
+	}
+	h.ok = true
+	h.p50, h.p95, h.p99 = percentile(times, 50), percentile(times, 95), percentile(times, 99)
+	h.jitter = jitter(ordered)
+	return h
+}
+
+// rankHosts scores the servers and sorts them best first. Servers that
+// answered nothing sink to the bottom.
+func rankHosts(rows []comparisonRow, weights scoreWeights) []hostRanking {
+	hosts := make([]hostRanking, len(rows))
+	var worstP99, worstLoss, worstJitter float64
+	for i, row := range rows {
+		hosts[i] = newHostRanking(row)
+		if hosts[i].ok {
+			worstP99 = max(worstP99, float64(hosts[i].p99))
+			worstLoss = max(worstLoss, hosts[i].loss)
+			worstJitter = max(worstJitter, hosts[i].jitter)
+		}
+	}
+	fraction := func(v, worst float64) float64 {
+		if worst == 0 {
+			return 0
+		}
+		return v / worst
+	}
+	for i := range hosts {
+		h := &hosts[i]
+		if !h.ok {
+			h.score = math.Inf(1)
+			continue
+		}
+		h.score = weights.latency*fraction(float64(h.p99), worstP99) +
+			weights.loss*fraction(h.loss, worstLoss) +
+			weights.jitter*fraction(h.jitter, worstJitter)
+	}
+	sort.SliceStable(hosts, func(i, j int) bool { return hosts[i].score < hosts[j].score })
+	return hosts
+}
+
+// recommendation explains why the best-ranked server won, from the figures
+// that carry weight, or returns false if no server answered.
+func recommendation(hosts []hostRanking, weights scoreWeights) (string, bool) {
+	if len(hosts) == 0 || !hosts[0].ok {
+		return "", false
+	}
+	best := hosts[0]
+	lowestP99, lowestLoss, lowestJitter := true, true, true
+	for _, h := range hosts[1:] {
+		if h.ok {
+			lowestP99 = lowestP99 && best.p99 <= h.p99
+			lowestLoss = lowestLoss && best.loss <= h.loss
+			lowestJitter = lowestJitter && best.jitter <= h.jitter
+		}
+	}
+	var reasons []string
+	if lowestP99 && weights.latency > 0 {
+		reasons = append(reasons, "lowest p99")
+	}
+	if lowestJitter && weights.jitter > 0 {
+		reasons = append(reasons, "lowest jitter")
+	}
+	switch {
+	case weights.loss == 0:
+	case best.loss == 0:
+		reasons = append(reasons, "0% loss")
+	case lowestLoss:
+		reasons = append(reasons, "lowest loss")
+	}
+	if len(reasons) == 0 {
+		return "best weighted score", true
+	}
+	if len(reasons) == 1 {
+		return reasons[0], true
+	}
+	return strings.Join(reasons[:len(reasons)-1], ", ") + " and " + reasons[len(reasons)-1], true
+}
+
+// printServerComparison prints the ranked servers side by side with the
+// figures that matter when picking one: tail latency, loss and jitter.
+func printServerComparison(hosts []hostRanking) {
+	width := len("Server")
+	for _, h := range hosts {
+		width = max(width, len(h.label))
+	}
+	line := strings.Repeat("─", width+2)
+
+	fmt.Printf("┌────┬%s┬────────┬────────┬───────────┬───────────┬───────────┬─────────────┬───────┐\n", line)
+	fmt.Printf("│  # │ %-*s │   OK   │ Loss %% │ p50 (μs)  │ p95 (μs)  │ p99 (μs)  │ Jitter (μs) │ Score │\n", width, "Server")
+	fmt.Printf("├────┼%s┼────────┼────────┼───────────┼───────────┼───────────┼─────────────┼───────┤\n", line)
+	for i, h := range hosts {
+		if !h.ok {
+			fmt.Printf("│ %2d │ %-*s │ %6d │ %6.1f │ %9s │ %9s │ %9s │ %11s │ %5s │\n", i+1, width, h.label, 0, h.loss, "-", "-", "-", "-", "-")
+			continue
+		}
+		fmt.Printf("│ %2d │ %-*s │ %6d │ %6.1f │ %9d │ %9d │ %9d │ %11.0f │ %5.3f │\n", i+1, width, h.label,
+			len(sortedSuccessfulTimes(h.results)), h.loss, h.p50, h.p95, h.p99, h.jitter, h.score)
+	}
+	fmt.Printf("└────┴%s┴────────┴────────┴───────────┴───────────┴───────────┴─────────────┴───────┘\n", line)
+}
+
+// stunURI returns the URI of a server measured over transport, so that the
+// ICE servers in a ranking name the transport that was actually measured.
+func stunURI(host, transport string) string {
+	switch transport {
+	case "tcp":
+		return "stun:" + host + "?transport=tcp"
+	case "tls":
+		return "stuns:" + host
+	case "dtls":
+		return "stuns:" + host + "?transport=udp"
+	}
+	return "stun:" + host
+}
+
+type jsonICEServer struct {
+	URLs string `json:"urls"`
+}
+
+type jsonRecommendation struct {
+	Label  string `json:"label"`
+	URI    string `json:"uri"`
+	Reason string `json:"reason"`
+}
+
+type jsonScoreWeights struct {
+	Latency float64 `json:"latency"`
+	Loss    float64 `json:"loss"`
+	Jitter  float64 `json:"jitter"`
+}
+
+type jsonRankedServer struct {
+	Rank   int        `json:"rank"`
+	Label  string     `json:"label"`
+	URI    string     `json:"uri"`
+	Score  *float64   `json:"score,omitempty"`
+	Report jsonReport `json:"report"`
+}
+
+// jsonRanking is the machine-readable form of a multi-server run.
+// ICEServers lists the servers that answered, best first, in the shape of
+// WebRTC's RTCIceServer, so tooling can drop it into a peer connection's
+// configuration.
+type jsonRanking struct {
+	Weights     jsonScoreWeights    `json:"score_weights"`
+	Recommended *jsonRecommendation `json:"recommended,omitempty"`
+	ICEServers  []jsonICEServer     `json:"ice_servers"`
+	Servers     []jsonRankedServer  `json:"servers"`
+}
+
+func buildJSONRanking(cfg config, hosts []hostRanking) jsonRanking {
+	w := cfg.scoreWeights
+	ranking := jsonRanking{
+		Weights:    jsonScoreWeights{Latency: w.latency, Loss: w.loss, Jitter: w.jitter},
+		ICEServers: []jsonICEServer{},
+	}
+	if reason, ok := recommendation(hosts, w); ok {
+		ranking.Recommended = &jsonRecommendation{Label: hosts[0].label, URI: hosts[0].uri, Reason: reason}
+	}
+	for i, h := range hosts {
+		server := jsonRankedServer{Rank: i + 1, Label: h.label, URI: h.uri, Report: buildJSONReport(h.results, cfg.exportPercentiles, cfg.warmup > 0)}
+		if h.ok {
+			score := h.score
+			server.Score = &score
+			ranking.ICEServers = append(ranking.ICEServers, jsonICEServer{URLs: h.uri})
+		}
+		ranking.Servers = append(ranking.Servers, server)
+	}
+	return ranking
+}
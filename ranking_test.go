@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseScoreWeights(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    scoreWeights
+		wantErr bool
+	}{
+		{in: "latency=0.5,loss=0.4,jitter=0.1", want: scoreWeights{latency: 0.5, loss: 0.4, jitter: 0.1}},
+		{in: " loss=1 , jitter=2", want: scoreWeights{loss: 1, jitter: 2}},
+		{in: "latency=1", want: scoreWeights{latency: 1}},
+		{in: "latency=0,loss=0", wantErr: true},
+		{in: "latency=-1,loss=1", wantErr: true},
+		{in: "latency", wantErr: true},
+		{in: "latency=fast", wantErr: true},
+		{in: "throughput=1", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScoreWeights(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseScoreWeights(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseScoreWeights(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if got := defaultScoreWeights.String(); got != "latency=0.5,loss=0.3,jitter=0.2" {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRate parses a request rate like "100/s", "6000/1m" or "100" (per
+// second) into requests per second.
+func parseRate(s string) (float64, error) {
+	count, per, ok := strings.Cut(s, "/")
+	period := time.Second
+	if ok {
+		if per != "" && (per[0] < '0' || per[0] > '9') {
+			per = "1" + per
+		}
+		d, err := time.ParseDuration(per)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid rate %q (want e.g. 100/s)", s)
+		}
+		period = d
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate %q (want e.g. 100/s)", s)
+	}
+	return n / period.Seconds(), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "100", want: 100},
+		{in: "100/s", want: 100},
+		{in: "100/1s", want: 100},
+		{in: "6000/1m", want: 100},
+		{in: "6000/m", want: 100},
+		{in: "5/500ms", want: 10},
+		{in: "0.5/s", want: 0.5},
+		{in: "1/h", want: 1.0 / 3600},
+		{in: "0/s", wantErr: true},
+		{in: "-5", wantErr: true},
+		{in: "100/", wantErr: true},
+		{in: "100/0s", wantErr: true},
+		{in: "100/fortnight", wantErr: true},
+		{in: "fast", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRate(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseRate(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pion/stun"
+)
+
+// defaultMaxRedirects is how many 300 Try Alternate responses are followed
+// before one is reported as a failure.
+const defaultMaxRedirects = 3
+
+// alternateServer returns the address a 300 Try Alternate response points
+// to.
+func alternateServer(m *stun.Message) (string, bool) {
+	var code stun.ErrorCodeAttribute
+	if code.GetFrom(m) != nil || code.Code != stun.CodeTryAlternate {
+		return "", false
+	}
+	var alt stun.AlternateServer
+	if alt.GetFrom(m) != nil {
+		return "", false
+	}
+	return net.JoinHostPort(alt.IP.String(), strconv.Itoa(alt.Port)), true
+}
+
+// follow moves the prober to addr, reconnecting if the transport needs it.
+// TLS and DTLS keep verifying the certificate against the original host
+// name, as the alternate server has to present one for it.
+func (p *prober) follow(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	p.addr, p.host = addr, host
+	return p.redial()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reelectMargin is how much lower than the current best server's score a
+// challenger's has to be before it takes over, so that two servers with
+// near-equal scores do not flap back and forth every summary.
+const reelectMargin = 0.1
+
+// serverElection tracks the best server across the summaries of a
+// multi-server monitoring run.
+type serverElection struct {
+	current string
+}
+
+// update looks at a new ranking and returns a notice if the best server
+// changed, which it does only when the current one stopped answering or
+// was clearly beaten.
+func (e *serverElection) update(hosts []hostRanking, weights scoreWeights) (string, bool) {
+	reason, ok := recommendation(hosts, weights)
+	if !ok {
+		return "", false
+	}
+	best := hosts[0]
+	if e.current == "" {
+		e.current = best.label
+		return fmt.Sprintf("best server is %s — %s", best.label, reason), true
+	}
+	if best.label == e.current {
+		return "", false
+	}
+	for _, h := range hosts {
+		if h.label == e.current && h.ok && best.score >= h.score*(1-reelectMargin) {
+			return "", false
+		}
+	}
+	previous := e.current
+	e.current = best.label
+	return fmt.Sprintf("best server changed from %s to %s — %s", previous, best.label, reason), true
+}
+
+// writeRankingFile replaces path with the JSON ranking, through a
+// temporary file so readers never see it half written.
+func writeRankingFile(path string, ranking jsonRanking) error {
+	data, err := json.MarshalIndent(ranking, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode ranking: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ranking-*")
+	if err != nil {
+		return fmt.Errorf("failed to write ranking file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write ranking file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write ranking file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write ranking file: %w", err)
+	}
+	return nil
+}
+
+// runMonitorHosts probes several servers every interval until SIGINT or
+// SIGTERM. Every summary it ranks them on that window's results, prints the
+// ranking and, when the best server changes, prints a notice and runs
+// cfg.alertCommand with the new server's URI in STUN_TIMING_BEST_URI. With
+// cfg.rankingFile set, the latest ranking is also kept in that file for
+// tools that configure ICE servers.
+func runMonitorHosts(cfg config, interval, summaryEvery time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var hosts []string
+	var probers []*prober
+	for _, host := range strings.Split(cfg.stunHost, ",") {
+		host = strings.TrimSpace(host)
+		p, err := newProber(cfg, host)
+		if err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+		defer p.Close()
+		hosts = append(hosts, host)
+		probers = append(probers, p)
+	}
+	fmt.Printf("Monitoring %d servers every %s, ranking every %s (Ctrl-C to stop)\n", len(hosts), interval, summaryEvery)
+
+	probeCfg := cfg
+	probeCfg.runCount = 1
+	probeCfg.duration = 0
+	probeCfg.interval = 0
+	probeCfg.quiet = true
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var election serverElection
+	windowStart := time.Now()
+	window := make([][]result, len(hosts))
+	rank := func() error {
+		rows := make([]comparisonRow, len(hosts))
+		for i, host := range hosts {
+			rows[i] = comparisonRow{label: host, uri: stunURI(host, cfg.transport), results: window[i]}
+		}
+		ranked := rankHosts(rows, cfg.scoreWeights)
+		var parts []string
+		for i, h := range ranked {
+			if !h.ok {
+				parts = append(parts, fmt.Sprintf("%d. %s (no answers)", i+1, h.label))
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%d. %s (p99 %d μs, %.1f%% loss)", i+1, h.label, h.p99, h.loss))
+		}
+		now := time.Now()
+		fmt.Printf("%s  ranking: %s\n", now.Format(time.RFC3339), strings.Join(parts, ", "))
+		if notice, changed := election.update(ranked, cfg.scoreWeights); changed {
+			fmt.Printf("%s  %s\n", now.Format(time.RFC3339), notice)
+			runAlertCommand(cfg.alertCommand, "best-server", notice, "STUN_TIMING_BEST_URI="+ranked[0].uri)
+		}
+		if cfg.rankingFile != "" {
+			// Tools reading the file should switch only when the election
+			// does, so the elected server stays first.
+			sort.SliceStable(ranked, func(i, j int) bool {
+				return ranked[i].label == election.current && ranked[j].label != election.current
+			})
+			return writeRankingFile(cfg.rankingFile, buildJSONRanking(cfg, ranked))
+		}
+		return nil
+	}
+
+	for {
+		for i, p := range probers {
+			results, err := p.run(probeCfg)
+			if err != nil {
+				return fmt.Errorf("host %s: %w", hosts[i], err)
+			}
+			window[i] = append(window[i], results...)
+		}
+		if time.Since(windowStart) >= summaryEvery {
+			if err := rank(); err != nil {
+				return err
+			}
+			windowStart = time.Now()
+			window = make([][]result, len(hosts))
+		}
+
+		select {
+		case <-ctx.Done():
+			if len(window[0]) > 0 {
+				if err := rank(); err != nil {
+					return err
+				}
+			}
+			fmt.Println("Stopped")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// A scenario is an ordered list of measurement steps read from a JSON file:
+//
+//	{"steps": [
+//	  {"type": "warmup", "count": 10},
+//	  {"type": "burst", "count": 200},
+//	  {"type": "steady", "count": 60, "interval": "1s"}
+//	]}
+//
+// All steps share one socket, so a warmup step primes the same NAT binding
+// and conntrack entry that later steps measure.
+type scenario struct {
+	Steps []scenarioStep `json:"steps"`
+}
+
+type scenarioStep struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Count     int    `json:"count"`
+	Interval  string `json:"interval"`
+	Transport string `json:"transport"`
+
+	interval time.Duration
+}
+
+func loadScenario(path string) (*scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	var sc scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %s has no steps", path)
+	}
+
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		switch step.Type {
+		case "warmup", "burst", "steady":
+		default:
+			return nil, fmt.Errorf("step %d: unknown type %q (want warmup, burst or steady)", i+1, step.Type)
+		}
+		if step.Count < 1 {
+			return nil, fmt.Errorf("step %d: count must be at least 1", i+1)
+		}
+		if step.Transport != "" && step.Transport != "udp" {
+			return nil, fmt.Errorf("step %d: unsupported transport %q", i+1, step.Transport)
+		}
+		if step.Interval != "" {
+			if step.interval, err = time.ParseDuration(step.Interval); err != nil {
+				return nil, fmt.Errorf("step %d: invalid interval: %w", i+1, err)
+			}
+		}
+		if step.Type == "steady" && step.interval == 0 {
+			return nil, fmt.Errorf("step %d: steady steps need an interval", i+1)
+		}
+		if step.Name == "" {
+			step.Name = step.Type
+		}
+	}
+
+	return &sc, nil
+}
+
+func runScenario(cfg config) error {
+	sc, err := loadScenario(cfg.scenario)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	for i, step := range sc.Steps {
+		fmt.Printf("\n=== Step %d/%d: %s (%s, %d requests) ===\n", i+1, len(sc.Steps), step.Name, step.Type, step.Count)
+
+		stepCfg := cfg
+		stepCfg.runCount = step.Count
+		stepCfg.duration = 0
+		stepCfg.interval = 0
+		if step.Type == "steady" {
+			stepCfg.interval = step.interval
+		}
+
+		results, err := p.run(stepCfg)
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+
+		if step.Type == "warmup" {
+			fmt.Println("Warmup complete, results not reported")
+			continue
+		}
+		printResults(stepCfg, results)
+		printASCIIHistogram(stepCfg, results)
+	}
+
+	return nil
+}
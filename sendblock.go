@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sendBlockThreshold is how long a send has to block before it is worth
+// reporting. Unloaded UDP sends return in tens of microseconds at most, so
+// a millisecond means the socket buffer was full.
+const sendBlockThreshold = time.Millisecond
+
+// sendTimingConn records how long each Write blocked, so that local send
+// backpressure can be told apart from network latency. A retransmitted
+// request is timed by its last Write.
+type sendTimingConn struct {
+	net.Conn
+
+	mu   sync.Mutex
+	last time.Duration
+}
+
+func (c *sendTimingConn) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.Conn.Write(b)
+	c.mu.Lock()
+	c.last = time.Since(start)
+	c.mu.Unlock()
+	return n, err
+}
+
+// lastWrite returns how long the most recent Write took.
+func (c *sendTimingConn) lastWrite() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// sendTimer finds the sendTimingConn underneath any other wrappers.
+func sendTimer(conn net.Conn) *sendTimingConn {
+	if ic, ok := conn.(*inspectConn); ok {
+		conn = ic.Conn
+	}
+	st, _ := conn.(*sendTimingConn)
+	return st
+}
+
+// printSendBlocking shows the distribution of send-block times, but only
+// when at least one send blocked noticeably.
+func printSendBlocking(results []result) {
+	var blocks []int64
+	var blocked int
+	for _, r := range results {
+		blocks = append(blocks, r.sendBlock.Microseconds())
+		if r.sendBlock >= sendBlockThreshold {
+			blocked++
+		}
+	}
+	if blocked == 0 {
+		return
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	fmt.Printf("\nSend blocking: %d of %d sends blocked for %d μs or more\n", blocked, len(blocks), sendBlockThreshold.Microseconds())
+	fmt.Println("┌───────┬───────────┐")
+	fmt.Printf("│ %%tile │ Time (μs) │\n")
+	fmt.Println("├───────┼───────────┤")
+	for _, p := range []float64{50, 90, 99, 100} {
+		fmt.Printf("│ %-5s │ %9d │\n", percentileCell(p), percentile(blocks, p))
+	}
+	fmt.Println("└───────┴───────────┘")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// recentWindow is how many of the latest samples the exported quantiles are
+// computed over.
+const recentWindow = 1000
+
+// rttBuckets are the upper bounds, in seconds, of the exported RTT
+// histogram.
+var rttBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// liveMetrics holds the state exposed by -serve. It is updated by the
+// measurement loop and read by HTTP handlers.
+type liveMetrics struct {
+	mu          sync.Mutex
+	host        string
+	requests    int
+	failures    int
+	lastRTT     int64
+	lastSuccess time.Time
+	lastMapped  string
+	recent      []int64
+
+	// bucketCounts[i] counts successful requests with an RTT of at most
+	// rttBuckets[i], over the whole run; sum and count go with them.
+	bucketCounts []int
+	rttSum       int64
+	rttCount     int
+}
+
+func (m *liveMetrics) record(r result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests++
+	if r.err != nil {
+		m.failures++
+		return
+	}
+	m.lastRTT = r.time
+	m.lastSuccess = r.start
+	if r.mapped != nil {
+		m.lastMapped = r.mapped.IP.String()
+	}
+	for i, le := range rttBuckets {
+		if float64(r.time)/1e6 <= le {
+			m.bucketCounts[i]++
+		}
+	}
+	m.rttSum += r.time
+	m.rttCount++
+	m.recent = append(m.recent, r.time)
+	if len(m.recent) > recentWindow {
+		m.recent = m.recent[len(m.recent)-recentWindow:]
+	}
+}
+
+func (m *liveMetrics) writePrometheus(w http.ResponseWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	label := fmt.Sprintf("{host=%q}", m.host)
+
+	fmt.Fprintln(w, "# HELP stun_requests_total STUN binding requests sent.")
+	fmt.Fprintln(w, "# TYPE stun_requests_total counter")
+	fmt.Fprintf(w, "stun_requests_total%s %d\n", label, m.requests)
+	fmt.Fprintln(w, "# HELP stun_request_failures_total STUN binding requests that failed or timed out.")
+	fmt.Fprintln(w, "# TYPE stun_request_failures_total counter")
+	fmt.Fprintf(w, "stun_request_failures_total%s %d\n", label, m.failures)
+	fmt.Fprintln(w, "# HELP stun_rtt_last_seconds RTT of the latest successful request.")
+	fmt.Fprintln(w, "# TYPE stun_rtt_last_seconds gauge")
+	fmt.Fprintf(w, "stun_rtt_last_seconds%s %g\n", label, float64(m.lastRTT)/1e6)
+
+	if m.lastMapped != "" {
+		fmt.Fprintln(w, "# HELP stun_mapped_address_info Mapped IP address in the latest successful response.")
+		fmt.Fprintln(w, "# TYPE stun_mapped_address_info gauge")
+		fmt.Fprintf(w, "stun_mapped_address_info{host=%q,address=%q} 1\n", m.host, m.lastMapped)
+	}
+
+	fmt.Fprintln(w, "# HELP stun_rtt_histogram_seconds RTT of every successful request since start.")
+	fmt.Fprintln(w, "# TYPE stun_rtt_histogram_seconds histogram")
+	for i, le := range rttBuckets {
+		fmt.Fprintf(w, "stun_rtt_histogram_seconds_bucket{host=%q,le=\"%g\"} %d\n", m.host, le, m.bucketCounts[i])
+	}
+	fmt.Fprintf(w, "stun_rtt_histogram_seconds_bucket{host=%q,le=\"+Inf\"} %d\n", m.host, m.rttCount)
+	fmt.Fprintf(w, "stun_rtt_histogram_seconds_sum%s %g\n", label, float64(m.rttSum)/1e6)
+	fmt.Fprintf(w, "stun_rtt_histogram_seconds_count%s %d\n", label, m.rttCount)
+
+	if len(m.recent) == 0 {
+		return
+	}
+	sorted := append([]int64(nil), m.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum int64
+	for _, t := range sorted {
+		sum += t
+	}
+
+	fmt.Fprintf(w, "# HELP stun_rtt_seconds RTT over the latest %d successful requests.\n", recentWindow)
+	fmt.Fprintln(w, "# TYPE stun_rtt_seconds summary")
+	for _, q := range []float64{50, 90, 95, 99} {
+		fmt.Fprintf(w, "stun_rtt_seconds{host=%q,quantile=\"%g\"} %g\n", m.host, q/100, float64(percentile(sorted, q))/1e6)
+	}
+	fmt.Fprintf(w, "stun_rtt_seconds_sum%s %g\n", label, float64(sum)/1e6)
+	fmt.Fprintf(w, "stun_rtt_seconds_count%s %d\n", label, len(sorted))
+}
+
+// healthy reports whether a request succeeded recently enough.
+func (m *liveMetrics) healthy(maxAge time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.lastSuccess.IsZero() && time.Since(m.lastSuccess) <= maxAge
+}
+
+// runServe probes the server every cfg.interval until SIGINT or SIGTERM and
+// serves the latest results over HTTP.
+func runServe(cfg config) error {
+	interval := cfg.interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	metrics := &liveMetrics{host: cfg.stunHost, bucketCounts: make([]int, len(rttBuckets))}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics.writePrometheus(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !metrics.healthy(3*interval + cfg.timeout) {
+			http.Error(w, "no recent successful STUN response", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	srv := &http.Server{Addr: cfg.serve, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	fmt.Printf("Serving metrics on %s (probing %s every %s)\n", cfg.serve, cfg.stunHost, interval)
+
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	probeCfg := cfg
+	probeCfg.runCount = 1
+	probeCfg.duration = 0
+	probeCfg.quiet = true
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		results, err := p.run(probeCfg)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			metrics.record(r)
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("Shutting down")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(shutdownCtx)
+		case err := <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return fmt.Errorf("metrics server: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
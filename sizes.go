@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pion/stun"
+)
+
+// padding is a stun.Setter that adds a PADDING attribute (RFC 5780) of the
+// given length, inflating the request without changing its meaning.
+type padding int
+
+func (p padding) AddTo(m *stun.Message) error {
+	m.Add(stun.AttrPadding, make([]byte, p))
+	return nil
+}
+
+// requestAttrs returns the padding of Binding request i: -alternate-size
+// pads every other request, and cfg.padding pads them all.
+func requestAttrs(cfg config, i int) []stun.Setter {
+	var setters []stun.Setter
+	if cfg.altSize > 0 && i%2 == 1 {
+		setters = append(setters, padding(cfg.altSize))
+	}
+	if cfg.padding > 0 {
+		setters = append(setters, padding(cfg.padding))
+	}
+	return setters
+}
+
+// printSizeComparison reports success rate and latency per request size, so
+// loss or delay that only affects large packets stands out.
+func printSizeComparison(results []result) {
+	var sizes []int
+	sent := make(map[int]int)
+	times := make(map[int][]int64)
+
+	for _, r := range results {
+		if _, ok := sent[r.size]; !ok {
+			sizes = append(sizes, r.size)
+		}
+		sent[r.size]++
+		if r.err == nil {
+			times[r.size] = append(times[r.size], r.time)
+		}
+	}
+
+	sort.Ints(sizes)
+
+	fmt.Println("\nResults by request size:")
+	fmt.Println("┌────────────┬────────┬─────────┬───────────┬───────────┬───────────┐")
+	fmt.Println("│ Size (B)   │  Sent  │ Success │ p50 (μs)  │ p75 (μs)  │ p100 (μs) │")
+	fmt.Println("├────────────┼────────┼─────────┼───────────┼───────────┼───────────┤")
+	for _, size := range sizes {
+		t := times[size]
+		rate := float64(len(t)) / float64(sent[size]) * 100
+		if len(t) == 0 {
+			fmt.Printf("│ %10d │ %6d │ %6.1f%% │ %9s │ %9s │ %9s │\n", size, sent[size], rate, "-", "-", "-")
+			continue
+		}
+		sort.Slice(t, func(i, j int) bool { return t[i] < t[j] })
+		fmt.Printf("│ %10d │ %6d │ %6.1f%% │ %9d │ %9d │ %9d │\n",
+			size, sent[size], rate, percentile(t, 50), percentile(t, 75), t[len(t)-1])
+	}
+	fmt.Println("└────────────┴────────┴─────────┴───────────┴───────────┴───────────┘")
+}
@@ -0,0 +1,59 @@
+package main
+
+import "math"
+
+func mean(times []int64) float64 {
+	var sum float64
+	for _, t := range times {
+		sum += float64(t)
+	}
+	return sum / float64(len(times))
+}
+
+// stddev returns the sample standard deviation of times.
+func stddev(times []int64) float64 {
+	if len(times) < 2 {
+		return 0
+	}
+	m := mean(times)
+	var sum float64
+	for _, t := range times {
+		d := float64(t) - m
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(times)-1))
+}
+
+// jitter returns the interarrival jitter of RFC 3550, section 6.4.1, over
+// times in the order they were measured: a running average of the change
+// between consecutive samples with a gain of 1/16. For round-trip times
+// this is the jitter a real-time media stream on the same path would see.
+func jitter(times []int64) float64 {
+	var j float64
+	for i := 1; i < len(times); i++ {
+		d := math.Abs(float64(times[i] - times[i-1]))
+		j += (d - j) / 16
+	}
+	return j
+}
+
+// percentileCI returns a distribution-free 95% confidence interval for the
+// p-th percentile of sorted, using the binomial order-statistic ranks around
+// n*p/100. bounded is false when there are too few samples for one of those
+// ranks, e.g. in the tail, and the interval has been cut off at the smallest
+// or largest sample.
+func percentileCI(sorted []int64, p float64) (lo, hi int64, bounded bool) {
+	n := float64(len(sorted))
+	q := p / 100
+	half := 1.96 * math.Sqrt(n*q*(1-q))
+	j := int(math.Floor(n*q - half))
+	k := int(math.Ceil(n*q + half))
+	bounded = j >= 0 && k <= len(sorted)-1
+	if j < 0 {
+		j = 0
+	}
+	if k > len(sorted)-1 {
+		k = len(sorted) - 1
+	}
+	return sorted[j], sorted[k], bounded
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestPercentileCI(t *testing.T) {
+	sorted := make([]int64, 100)
+	for i := range sorted {
+		sorted[i] = int64(i)
+	}
+	tests := []struct {
+		p       float64
+		lo, hi  int64
+		bounded bool
+	}{
+		{50, 40, 60, true},
+		{90, 84, 96, true},
+		{99, 97, 99, false},
+		{1, 0, 3, false},
+	}
+	for _, tt := range tests {
+		lo, hi, bounded := percentileCI(sorted, tt.p)
+		if lo != tt.lo || hi != tt.hi || bounded != tt.bounded {
+			t.Errorf("percentileCI(p%v) = %d, %d, %v, want %d, %d, %v", tt.p, lo, hi, bounded, tt.lo, tt.hi, tt.bounded)
+		}
+	}
+}
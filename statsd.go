@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// statsdClient sends per-request metrics to a statsd server. Tags, given as
+// key:value pairs, are sent in DogStatsD syntax; without any, the output is
+// plain statsd.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+func dialStatsd(addr, prefix string, tags []string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial statsd: %w", err)
+	}
+	return &statsdClient{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// hook returns a responseHook reporting requests to host as they complete.
+func (c *statsdClient) hook(host string) responseHook {
+	suffix := ""
+	if len(c.tags) > 0 {
+		suffix = "|#" + strings.Join(append([]string{"target:" + host}, c.tags...), ",")
+	}
+
+	return func(_ int, _ *stun.Message, rtt time.Duration, err error) {
+		// Metrics are best effort: a missing statsd server must not fail
+		// the measurement.
+		fmt.Fprintf(c.conn, "%srequests:1|c%s", c.prefix, suffix)
+		if err != nil {
+			fmt.Fprintf(c.conn, "%serrors:1|c%s", c.prefix, suffix)
+			return
+		}
+		fmt.Fprintf(c.conn, "%srtt:%g|ms%s", c.prefix, float64(rtt.Microseconds())/1000, suffix)
+	}
+}
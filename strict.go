@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+var (
+	errBadFingerprint     = errors.New("invalid FINGERPRINT")
+	errUnknownTransaction = errors.New("response with unknown transaction ID")
+)
+
+// checkFingerprint validates the FINGERPRINT of a response. In strict mode a
+// response without one is as suspect as one with the wrong CRC.
+func checkFingerprint(m *stun.Message) error {
+	err := stun.Fingerprint.Check(m)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, stun.ErrAttributeNotFound):
+		return fmt.Errorf("%w: missing", errBadFingerprint)
+	default:
+		return errBadFingerprint
+	}
+}
+
+// txidRetention is how many request timeouts a transaction ID is
+// remembered for. A late response arrives after its request timed out, so
+// the ID has to outlive the timeout for the response to be recognized.
+const txidRetention = 2
+
+// sentTxid is a transaction ID and when it was sent.
+type sentTxid struct {
+	txid [stun.TransactionIDSize]byte
+	at   time.Time
+}
+
+// txidTracker remembers the transaction IDs a prober sent, so that a
+// response matching none of them, which pion drops, can be told apart from a
+// late response to a request that already timed out. IDs are forgotten
+// after txidRetention timeouts, so long runs do not accumulate them.
+type txidTracker struct {
+	mu    sync.Mutex
+	sent  map[[stun.TransactionIDSize]byte]struct{}
+	order []sentTxid
+	keep  time.Duration
+	stray bool
+}
+
+func newTxidTracker(timeout time.Duration) *txidTracker {
+	return &txidTracker{
+		sent: make(map[[stun.TransactionIDSize]byte]struct{}),
+		keep: txidRetention * timeout,
+	}
+}
+
+func (t *txidTracker) send(txid [stun.TransactionIDSize]byte) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// IDs are sent in order, so the expired ones are at the front.
+	for len(t.order) > 0 && now.Sub(t.order[0].at) > t.keep {
+		delete(t.sent, t.order[0].txid)
+		t.order = t.order[1:]
+	}
+	t.sent[txid] = struct{}{}
+	t.order = append(t.order, sentTxid{txid: txid, at: now})
+}
+
+// receive is called for responses that matched no pending transaction.
+func (t *txidTracker) receive(m *stun.Message) {
+	t.mu.Lock()
+	if _, ok := t.sent[m.TransactionID]; !ok {
+		t.stray = true
+	}
+	t.mu.Unlock()
+}
+
+// takeStray reports whether a response with an unknown transaction ID
+// arrived since the last call.
+func (t *txidTracker) takeStray() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stray := t.stray
+	t.stray = false
+	return stray
+}
+
+// printInvalid counts responses that arrived but failed validation
+// separately from requests that got no response at all.
+func printInvalid(results []result) {
+	var fingerprint, txid, truncated, malformed, timeouts int
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, errBadFingerprint):
+			fingerprint++
+		case errors.Is(r.err, errUnknownTransaction):
+			txid++
+		case errors.Is(r.err, errTruncated):
+			truncated++
+		case errors.Is(r.err, errMalformed):
+			malformed++
+		case errors.Is(r.err, stun.ErrTransactionTimeOut):
+			timeouts++
+		}
+	}
+
+	fmt.Printf("\nInvalid responses: %d\n", fingerprint+txid+truncated+malformed)
+	fmt.Printf("  bad FINGERPRINT:        %d\n", fingerprint)
+	fmt.Printf("  unknown transaction ID: %d\n", txid)
+	fmt.Printf("  truncated:              %d\n", truncated)
+	fmt.Printf("  malformed:              %d\n", malformed)
+	fmt.Printf("Timeouts: %d\n", timeouts)
+}
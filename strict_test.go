@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+func TestCheckFingerprint(t *testing.T) {
+	build := func(setters ...stun.Setter) *stun.Message {
+		base := []stun.Setter{stun.TransactionID, stun.BindingSuccess, &stun.XORMappedAddress{IP: net.IPv4(192, 0, 2, 1), Port: 3478}}
+		return stun.MustBuild(append(base, setters...)...)
+	}
+
+	corrupted := build(stun.Fingerprint)
+	corrupted.Raw[len(corrupted.Raw)-1] ^= 0xff
+	decode := func(m *stun.Message) *stun.Message {
+		d := &stun.Message{Raw: append([]byte(nil), m.Raw...)}
+		if err := d.Decode(); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		m       *stun.Message
+		wantErr bool
+	}{
+		{"valid", decode(build(stun.Fingerprint)), false},
+		{"missing", decode(build()), true},
+		{"wrong CRC", decode(corrupted), true},
+	}
+	for _, tt := range tests {
+		err := checkFingerprint(tt.m)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkFingerprint() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errBadFingerprint) {
+			t.Errorf("%s: %v is not errBadFingerprint", tt.name, err)
+		}
+	}
+}
+
+func TestTxidTracker(t *testing.T) {
+	tr := newTxidTracker(5 * time.Millisecond)
+	old := stun.NewTransactionID()
+	tr.send(old)
+	tr.receive(&stun.Message{TransactionID: old})
+	if tr.takeStray() {
+		t.Error("a response to a request sent is stray")
+	}
+
+	tr.receive(&stun.Message{TransactionID: stun.NewTransactionID()})
+	if !tr.takeStray() {
+		t.Error("a response to no request sent is not stray")
+	}
+	if tr.takeStray() {
+		t.Error("takeStray did not reset")
+	}
+
+	// Sending after txidRetention timeouts forgets the old ID.
+	time.Sleep(txidRetention*5*time.Millisecond + time.Millisecond)
+	tr.send(stun.NewTransactionID())
+	if len(tr.order) != 1 || len(tr.sent) != 1 {
+		t.Errorf("tracker holds %d IDs, want 1", len(tr.sent))
+	}
+	tr.receive(&stun.Message{TransactionID: old})
+	if !tr.takeStray() {
+		t.Error("a response to a forgotten request is not stray")
+	}
+}
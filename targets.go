@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pion/stun"
+)
+
+// target is one line of a -targets file: a STUN or TURN URI, or a bare
+// host:port, optionally followed by a label for the report. uri is always
+// a full URI.
+type target struct {
+	uri       string
+	label     string
+	host      string
+	transport string
+}
+
+// readTargets reads a -targets file.
+func readTargets(path, transport string) ([]target, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open targets file: %w", err)
+	}
+	defer f.Close()
+	return parseTargets(f, path, transport)
+}
+
+// parseTargets parses a list of targets, one per line, naming the list
+// name in errors. Blank lines and lines starting with # are skipped. Bare
+// hosts and stun: URIs use transport.
+func parseTargets(r io.Reader, name, transport string) ([]target, error) {
+	var targets []target
+	var err error
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		uri, label, _ := strings.Cut(text, " ")
+		t := target{uri: uri, label: strings.TrimSpace(label), host: uri, transport: transport}
+		if t.label == "" {
+			t.label = uri
+		}
+		switch {
+		case strings.HasPrefix(uri, "stun:"), strings.HasPrefix(uri, "stuns:"):
+			if t.host, t.transport, err = parseSTUNURI(uri, transport); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+			t.uri = stunURI(t.host, t.transport)
+		case strings.HasPrefix(uri, "turn:"), strings.HasPrefix(uri, "turns:"):
+			if t.host, t.transport, err = parseTURNURI(uri); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		default:
+			t.uri = stunURI(uri, transport)
+		}
+		targets = append(targets, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", name)
+	}
+	return targets, nil
+}
+
+// parseSTUNURI returns the address and transport of a stun: or stuns: URI,
+// with the default port of its scheme if it names none. RFC 7064 gives
+// these schemes no query, but the ?transport= that stunURI adds for TCP
+// and DTLS is accepted so that reported URIs can be measured again. A
+// stun: URI without one uses transport.
+func parseSTUNURI(raw, transport string) (host, uriTransport string, err error) {
+	base, query, _ := strings.Cut(raw, "?")
+	u, err := stun.ParseURI(base)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse STUN URI: %w", err)
+	}
+	proto := params.Get("transport")
+	if len(params) > 1 || (len(params) == 1 && proto == "") {
+		return "", "", fmt.Errorf("unsupported query in STUN URI: %s", raw)
+	}
+	switch {
+	case u.Scheme == stun.SchemeTypeSTUN && proto == "":
+		uriTransport = transport
+	case u.Scheme == stun.SchemeTypeSTUN && (proto == "udp" || proto == "tcp"):
+		uriTransport = proto
+	case u.Scheme == stun.SchemeTypeSTUNS && (proto == "" || proto == "tcp"):
+		uriTransport = "tls"
+	case u.Scheme == stun.SchemeTypeSTUNS && proto == "udp":
+		uriTransport = "dtls"
+	default:
+		return "", "", fmt.Errorf("unsupported transport %q in STUN URI: %s", proto, raw)
+	}
+	return net.JoinHostPort(u.Host, strconv.Itoa(u.Port)), uriTransport, nil
+}
+
+// runTargets measures every target in the -targets file in turn, each over
+// its own transport, and reports them together: ranked side by side as
+// text, or as one JSON ranking with a report per target. TURN servers
+// answer Binding requests too, which is what is measured for them.
+func runTargets(cfg config) error {
+	targets, err := readTargets(cfg.targetsFile, cfg.transport)
+	if err != nil {
+		return err
+	}
+	return measureTargets(cfg, targets, false)
+}
+
+// measureTargets measures targets in turn and reports them together. With
+// skipFailed, a target that cannot be measured at all, e.g. because its
+// name no longer resolves, is left out instead of ending the run.
+func measureTargets(cfg config, targets []target, skipFailed bool) error {
+	var rows []comparisonRow
+	for _, t := range targets {
+		fmt.Fprintf(cfg.logOutput(), "\n== %s ==\n", t.label)
+		targetCfg := cfg
+		targetCfg.stunHost, targetCfg.transport = t.host, t.transport
+		results, err := runSTUNRequests(targetCfg, t.host)
+		if err != nil && skipFailed {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", t.label, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("target %s: %w", t.label, err)
+		}
+		rows = append(rows, comparisonRow{label: t.label, uri: t.uri, results: results})
+	}
+
+	if len(rows) == 0 {
+		return errors.New("no target could be measured")
+	}
+	return reportHosts(cfg, rows)
+}
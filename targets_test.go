@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		line      string
+		host      string
+		transport string
+		uri       string
+		label     string
+	}{
+		{"stun.example:3478", "stun.example:3478", "udp", "stun:stun.example:3478", "stun.example:3478"},
+		{"stun:stun.example", "stun.example:3478", "udp", "stun:stun.example:3478", "stun:stun.example"},
+		{"stun:stun.example:19302 Google", "stun.example:19302", "udp", "stun:stun.example:19302", "Google"},
+		{"stun:stun.example:3478?transport=tcp", "stun.example:3478", "tcp", "stun:stun.example:3478?transport=tcp", "stun:stun.example:3478?transport=tcp"},
+		{"stuns:stun.example", "stun.example:5349", "tls", "stuns:stun.example:5349", "stuns:stun.example"},
+		{"stuns:stun.example:443?transport=udp", "stun.example:443", "dtls", "stuns:stun.example:443?transport=udp", "stuns:stun.example:443?transport=udp"},
+		{"stun:[2001:db8::1]:3478", "[2001:db8::1]:3478", "udp", "stun:[2001:db8::1]:3478", "stun:[2001:db8::1]:3478"},
+		{"turn:turn.example?transport=tcp", "turn.example:3478", "tcp", "turn:turn.example?transport=tcp", "turn:turn.example?transport=tcp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			targets, err := parseTargets(strings.NewReader(tt.line), "test", "udp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := targets[0]
+			if got.host != tt.host || got.transport != tt.transport || got.uri != tt.uri || got.label != tt.label {
+				t.Errorf("got %+v, want host %q transport %q uri %q label %q", got, tt.host, tt.transport, tt.uri, tt.label)
+			}
+		})
+	}
+}
+
+// TestParseTargetsRoundTrip feeds the URIs that rankings recommend back in
+// as targets.
+func TestParseTargetsRoundTrip(t *testing.T) {
+	for _, transport := range []string{"udp", "tcp", "tls", "dtls"} {
+		uri := stunURI("stun.example:3478", transport)
+		targets, err := parseTargets(strings.NewReader(uri), "test", "udp")
+		if err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		if got := targets[0]; got.host != "stun.example:3478" || got.transport != transport {
+			t.Errorf("%s: got host %q transport %q, want stun.example:3478 %s", uri, got.host, got.transport, transport)
+		}
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	for _, line := range []string{
+		"stun:stun.example:3478?transport=sctp",
+		"stun:stun.example:3478?foo=bar",
+		"stun:stun.example:port",
+		"# only a comment",
+	} {
+		if _, err := parseTargets(strings.NewReader(line), "test", "udp"); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
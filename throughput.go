@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The throughput benchmark offers open-loop load for throughputStep at a
+// time, starting at throughputFirstRate and doubling until the server can no
+// longer keep up, then bisects throughputBisections times between the last
+// rate it sustained and the first it did not.
+const (
+	throughputFirstRate   = 100
+	throughputMaxRate     = 1_000_000
+	throughputStep        = 5 * time.Second
+	throughputBisections  = 3
+	throughputMinAchieved = 0.95
+)
+
+// throughputStepResult is the outcome of offering one rate.
+type throughputStepResult struct {
+	offered  float64
+	achieved float64
+	sent     int
+	failed   int
+	times    []int64
+	ok       bool
+}
+
+// sustained reports whether the server kept up with the offered rate: it
+// answered nearly every request, at nearly the offered rate, without the
+// latency climbing well above what it was at the lowest rate.
+func (s *throughputStepResult) sustained(baseline95 int64) bool {
+	if len(s.times) == 0 || float64(s.failed)/float64(s.sent)*100 > rampMaxLoss || s.achieved < s.offered*throughputMinAchieved {
+		return false
+	}
+	return baseline95 == 0 || float64(percentile(s.times, 95)) <= float64(baseline95)*kneeFactor
+}
+
+func offerRate(cfg config, rate float64) (*throughputStepResult, error) {
+	stepCfg := cfg
+	stepCfg.rate = rate
+	stepCfg.ramp = nil
+	stepCfg.reorder = true
+	stepCfg.runCount = max(int(rate*throughputStep.Seconds()), 1)
+	stepCfg.quiet = true
+	results, err := runAsyncRequests(stepCfg, cfg.stunHost)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &throughputStepResult{offered: rate, sent: len(results), times: sortedSuccessfulTimes(results)}
+	s.failed = s.sent - len(s.times)
+	// The achieved rate runs from the first send to the last answer.
+	var last time.Time
+	for _, r := range results {
+		if answered := r.start.Add(time.Duration(r.time) * time.Microsecond); r.err == nil && answered.After(last) {
+			last = answered
+		}
+	}
+	if !last.IsZero() {
+		s.achieved = float64(len(s.times)) / last.Sub(results[0].start).Seconds()
+	}
+	return s, nil
+}
+
+// runThroughput finds the highest Binding request rate the server sustains
+// and reports the latency and failure rate at that rate.
+func runThroughput(cfg config) error {
+	if cfg.transport != "udp" {
+		return errors.New("-throughput needs -transport udp")
+	}
+	fmt.Printf("Throughput benchmark against %s, %s per rate\n\n", cfg.stunHost, throughputStep)
+	fmt.Println("┌─────────────┬──────────────┬──────────┬───────────┬───────────┬───────────┬────────────┐")
+	fmt.Println("│ Offered r/s │ Achieved r/s │ Failed % │ p50 (μs)  │ p95 (μs)  │ p99 (μs)  │ Sustained  │")
+	fmt.Println("├─────────────┼──────────────┼──────────┼───────────┼───────────┼───────────┼────────────┤")
+
+	var baseline95 int64
+	var best *throughputStepResult
+	try := func(rate float64) (bool, error) {
+		s, err := offerRate(cfg, rate)
+		if err != nil {
+			return false, err
+		}
+		s.ok = s.sustained(baseline95)
+		if baseline95 == 0 && len(s.times) > 0 {
+			baseline95 = percentile(s.times, 95)
+		}
+		printThroughputStep(s)
+		if s.ok && (best == nil || s.offered > best.offered) {
+			best = s
+		}
+		return s.ok, nil
+	}
+
+	good, bad := 0.0, 0.0
+	for rate := float64(throughputFirstRate); rate <= throughputMaxRate; rate *= 2 {
+		ok, err := try(rate)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			bad = rate
+			break
+		}
+		good = rate
+	}
+	for i := 0; i < throughputBisections && good > 0 && bad > 0; i++ {
+		rate := (good + bad) / 2
+		ok, err := try(rate)
+		if err != nil {
+			return err
+		}
+		if ok {
+			good = rate
+		} else {
+			bad = rate
+		}
+	}
+	fmt.Println("└─────────────┴──────────────┴──────────┴───────────┴───────────┴───────────┴────────────┘")
+
+	if best == nil {
+		fmt.Printf("\nThe server did not sustain even %d requests/s\n", throughputFirstRate)
+		return nil
+	}
+	fmt.Printf("\nMaximum sustained rate: %.0f requests/s (achieved %.0f/s)\n", best.offered, best.achieved)
+	fmt.Printf("At that rate: p50 %d μs, p95 %d μs, p99 %d μs, %.2f%% failed\n",
+		percentile(best.times, 50), percentile(best.times, 95), percentile(best.times, 99),
+		float64(best.failed)/float64(best.sent)*100)
+	if bad == 0 {
+		fmt.Printf("The server kept up with every rate tried, up to %d requests/s\n", throughputMaxRate)
+	}
+	return nil
+}
+
+func printThroughputStep(s *throughputStepResult) {
+	verdict := "yes"
+	if !s.ok {
+		verdict = "no"
+	}
+	failed := float64(s.failed) / float64(max(s.sent, 1)) * 100
+	if len(s.times) == 0 {
+		fmt.Printf("│ %11.0f │ %12.0f │ %8.2f │ %9s │ %9s │ %9s │ %-10s │\n", s.offered, s.achieved, failed, "-", "-", "-", verdict)
+		return
+	}
+	fmt.Printf("│ %11.0f │ %12.0f │ %8.2f │ %9d │ %9d │ %9d │ %-10s │\n", s.offered, s.achieved, failed,
+		percentile(s.times, 50), percentile(s.times, 95), percentile(s.times, 99), verdict)
+}
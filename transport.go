@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pion/dtls/v2"
+)
+
+// streamConn delivers one STUN message per Read over a stream transport.
+// STUN over TCP has no framing of its own (RFC 5389 section 7.2.2); each
+// message is delimited by the length in its header, and a single TCP read
+// may return part of a message or several of them.
+type streamConn struct {
+	net.Conn
+	header [stunHeaderSize]byte
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	if _, err := io.ReadFull(c.Conn, c.header[:]); err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(c.header[2:4]))
+	if stunHeaderSize+length > len(b) {
+		return 0, fmt.Errorf("STUN message of %d bytes does not fit the %d byte buffer", stunHeaderSize+length, len(b))
+	}
+	copy(b, c.header[:])
+	if _, err := io.ReadFull(c.Conn, b[stunHeaderSize:stunHeaderSize+length]); err != nil {
+		return 0, err
+	}
+	return stunHeaderSize + length, nil
+}
+
+// addrIPPort returns the IP and port of a UDP or TCP address.
+func addrIPPort(a net.Addr) (net.IP, int) {
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	}
+	return nil, 0
+}
+
+// newTLSConfig builds the client TLS configuration for a stuns: server.
+func newTLSConfig(cfg config, host string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: cfg.tlsInsecure,
+	}
+	if cfg.tlsServerName != "" {
+		tlsCfg.ServerName = cfg.tlsServerName
+	}
+	if cfg.tlsCA != "" {
+		pem, err := os.ReadFile(cfg.tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.tlsCA)
+		}
+	}
+	return tlsCfg, nil
+}
+
+// newDTLSConfig builds the client DTLS configuration from the same
+// verification options as TLS.
+func newDTLSConfig(cfg config, host string) (*dtls.Config, error) {
+	tlsCfg, err := newTLSConfig(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+	return &dtls.Config{
+		ServerName:         tlsCfg.ServerName,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+		RootCAs:            tlsCfg.RootCAs,
+	}, nil
+}
+
+// printConnectSetup reports how long establishing connections took, which
+// is not part of any request's RTT.
+func printConnectSetup(results []result, transport string) {
+	var lookups, connects, handshakes []int64
+	for _, r := range results {
+		if r.lookup > 0 {
+			lookups = append(lookups, r.lookup.Microseconds())
+		}
+		if r.connect > 0 {
+			connects = append(connects, r.connect.Microseconds())
+		}
+		if r.handshake > 0 {
+			handshakes = append(handshakes, r.handshake.Microseconds())
+		}
+	}
+	if len(lookups) > 0 || len(connects) > 0 || len(handshakes) > 0 {
+		fmt.Println()
+	}
+	printSetupTimes("DNS lookup", lookups)
+	printSetupTimes("TCP connection setup", connects)
+	printSetupTimes(strings.ToUpper(transport)+" handshake", handshakes)
+}
+
+func printSetupTimes(label string, times []int64) {
+	switch len(times) {
+	case 0:
+	case 1:
+		fmt.Printf("%s: %d μs\n", label, times[0])
+	default:
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		fmt.Printf("%s over %d connections: p50 %d μs, p100 %d μs\n",
+			label, len(times), percentile(times, 50), times[len(times)-1])
+	}
+}
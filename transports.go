@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// transportRun is one transport of a -transports comparison and the
+// host:port it is measured against.
+type transportRun struct {
+	label     string
+	transport string
+	host      string
+}
+
+// stunsPort is the default port of STUN over TLS and DTLS (RFC 7350).
+const stunsPort = "5349"
+
+// parseTransportRuns parses a list like "udp,tcp,tls:5349". Each transport
+// is measured against host, on the port given after it if any. Otherwise
+// UDP and TCP use the host's port and TLS and DTLS use 5349.
+func parseTransportRuns(s, host string) ([]transportRun, error) {
+	name, hostPort, err := splitSTUNHost(host)
+	if err != nil {
+		return nil, err
+	}
+	var runs []transportRun
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		transport, port, ok := strings.Cut(part, ":")
+		switch transport {
+		case "udp", "tcp", "tls", "dtls":
+		default:
+			return nil, fmt.Errorf("unknown transport %q in -transports (want udp, tcp, tls or dtls, each optionally :port)", transport)
+		}
+		if !ok {
+			port = hostPort
+			if transport == "tls" || transport == "dtls" {
+				port = stunsPort
+			}
+		}
+		run := transportRun{label: part, transport: transport, host: net.JoinHostPort(name, port)}
+		runs = append(runs, run)
+	}
+	if len(runs) < 2 {
+		return nil, fmt.Errorf("-transports wants at least two transports (got %q)", s)
+	}
+	return runs, nil
+}
+
+// transportMeasurement is the result of measuring one transport: its
+// requests and how long setting up each of its connections took.
+type transportMeasurement struct {
+	run        transportRun
+	results    []result
+	connects   []int64
+	handshakes []int64
+}
+
+// setup returns the median connection setup time, TCP connect plus any
+// TLS or DTLS handshake, in μs.
+func (m transportMeasurement) setup() int64 {
+	return medianMicros(m.connects) + medianMicros(m.handshakes)
+}
+
+func medianMicros(times []int64) int64 {
+	if len(times) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return percentile(sorted, 50)
+}
+
+// measureTransport runs the requests for one transport, keeping the setup
+// time of the first connection even when a warm-up takes it over.
+func measureTransport(cfg config, run transportRun) (transportMeasurement, error) {
+	m := transportMeasurement{run: run}
+	runCfg := cfg
+	runCfg.stunHost, runCfg.transport = run.host, run.transport
+	p, err := newProber(runCfg, run.host)
+	if err != nil {
+		return m, err
+	}
+	defer p.Close()
+
+	if cfg.warmup > 0 {
+		setup, handshake := p.setup, p.handshake
+		answered, first, err := p.warmUp(runCfg)
+		if err != nil {
+			return m, err
+		}
+		printWarmUp(cfg, cfg.warmup, answered, first)
+		p.setup, p.handshake = setup, handshake
+	}
+	if m.results, err = p.run(runCfg); err != nil {
+		return m, err
+	}
+	for _, r := range m.results {
+		if r.connect > 0 {
+			m.connects = append(m.connects, r.connect.Microseconds())
+		}
+		if r.handshake > 0 {
+			m.handshakes = append(m.handshakes, r.handshake.Microseconds())
+		}
+	}
+	return m, nil
+}
+
+// runTransportComparison measures the same server over several transports
+// in one run and reports each one's connection setup cost next to its
+// steady-state RTT, to show what falling back from UDP to TCP or TLS costs.
+func runTransportComparison(cfg config) error {
+	runs, err := parseTransportRuns(cfg.transports, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+
+	var measurements []transportMeasurement
+	for _, run := range runs {
+		fmt.Fprintf(cfg.logOutput(), "\n== %s ==\n", run.label)
+		m, err := measureTransport(cfg, run)
+		if err != nil {
+			return fmt.Errorf("transport %s: %w", run.label, err)
+		}
+		measurements = append(measurements, m)
+	}
+
+	fmt.Println()
+	printTransportComparison(measurements)
+
+	base := measurements[0]
+	baseTimes := sortedSuccessfulTimes(base.results)
+	if len(baseTimes) == 0 {
+		return nil
+	}
+	fmt.Println()
+	for _, m := range measurements[1:] {
+		times := sortedSuccessfulTimes(m.results)
+		if len(times) == 0 {
+			fmt.Printf("%s → %s: no answers over %s\n", base.run.label, m.run.label, m.run.label)
+			continue
+		}
+		fmt.Printf("%s → %s: %+d μs connection setup, %+d μs per request at p50, %+d μs at p99\n",
+			base.run.label, m.run.label, m.setup()-base.setup(),
+			percentile(times, 50)-percentile(baseTimes, 50), percentile(times, 99)-percentile(baseTimes, 99))
+	}
+	return nil
+}
+
+// printTransportComparison prints one line per transport with the median
+// connection setup times, which are not part of any request's RTT, and the
+// RTT percentiles.
+func printTransportComparison(measurements []transportMeasurement) {
+	width := len("Transport")
+	for _, m := range measurements {
+		width = max(width, len(m.run.label))
+	}
+	line := strings.Repeat("─", width+2)
+	setup := func(times []int64) string {
+		if len(times) == 0 {
+			return "-"
+		}
+		return fmt.Sprint(medianMicros(times))
+	}
+
+	fmt.Printf("┌%s┬──────────────┬────────────────┬────────┬────────┬───────────┬───────────┬───────────┐\n", line)
+	fmt.Printf("│ %-*s │ Connect (μs) │ Handshake (μs) │   OK   │ Failed │ p50 (μs)  │ p95 (μs)  │ p99 (μs)  │\n", width, "Transport")
+	fmt.Printf("├%s┼──────────────┼────────────────┼────────┼────────┼───────────┼───────────┼───────────┤\n", line)
+	for _, m := range measurements {
+		times := sortedSuccessfulTimes(m.results)
+		failed := len(m.results) - len(times)
+		if len(times) == 0 {
+			fmt.Printf("│ %-*s │ %12s │ %14s │ %6d │ %6d │ %9s │ %9s │ %9s │\n", width, m.run.label,
+				setup(m.connects), setup(m.handshakes), 0, failed, "-", "-", "-")
+			continue
+		}
+		fmt.Printf("│ %-*s │ %12s │ %14s │ %6d │ %6d │ %9d │ %9d │ %9d │\n", width, m.run.label,
+			setup(m.connects), setup(m.handshakes), len(times), failed,
+			percentile(times, 50), percentile(times, 95), percentile(times, 99))
+	}
+	fmt.Printf("└%s┴──────────────┴────────────────┴────────┴────────┴───────────┴───────────┴───────────┘\n", line)
+}
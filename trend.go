@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// A level shift is reported when the moving median of the last
+// shortAverageSamples RTTs moves levelShiftFactor times away from the
+// baseline, a moving average of that median over about baselineSamples
+// RTTs, and by at least levelShiftMin μs. The median keeps a single slow
+// response from looking like a shift. A trend is reported when the mean
+// RTT of trendWindows consecutive summary windows rose every time, by
+// trendMinRise overall.
+const (
+	shortAverageSamples = 10
+	baselineSamples     = 100
+	levelShiftFactor    = 1.5
+	levelShiftMin       = 1000
+	trendWindows        = 4
+	trendMinRise        = 1.2
+)
+
+// trendDetector watches the RTTs of a monitoring run for changes in the
+// baseline latency.
+type trendDetector struct {
+	recent          []int64
+	short, baseline float64
+	// samples counts the RTTs folded into the baseline since it was last
+	// reset; shifts are only reported once it has settled.
+	samples     int
+	windowMeans []float64
+	rising      bool
+}
+
+// ewma moves avg towards v as an exponential moving average over about n
+// samples.
+func ewma(avg, v float64, n int) float64 {
+	return avg + (v-avg)*2/float64(n+1)
+}
+
+// add folds one RTT into the moving median and average and returns a
+// notice if the latency has shifted away from the baseline, which then
+// restarts at the new level.
+func (t *trendDetector) add(rtt int64) string {
+	t.recent = append(t.recent, rtt)
+	if len(t.recent) > shortAverageSamples {
+		t.recent = t.recent[1:]
+	}
+	sorted := append([]int64(nil), t.recent...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	t.short = float64(percentile(sorted, 50))
+	if t.samples == 0 {
+		t.baseline = t.short
+	}
+	t.baseline = ewma(t.baseline, t.short, baselineSamples)
+	t.samples++
+	if t.samples < baselineSamples {
+		return ""
+	}
+
+	ratio := t.short / t.baseline
+	if math.Abs(t.short-t.baseline) < levelShiftMin || (ratio < levelShiftFactor && ratio > 1/levelShiftFactor) {
+		return ""
+	}
+	direction := "up"
+	if ratio < 1 {
+		direction = "down"
+	}
+	notice := fmt.Sprintf("latency level shift %s: moving median %.0f μs, baseline was %.0f μs", direction, t.short, t.baseline)
+	t.baseline = t.short
+	t.samples = 0
+	return notice
+}
+
+// endWindow records the mean RTT of a summary window and returns a notice
+// when the window means have been rising steadily.
+func (t *trendDetector) endWindow(mean float64) string {
+	t.windowMeans = append(t.windowMeans, mean)
+	if len(t.windowMeans) > trendWindows {
+		t.windowMeans = t.windowMeans[1:]
+	}
+	rising := len(t.windowMeans) == trendWindows
+	for i := 1; rising && i < len(t.windowMeans); i++ {
+		rising = t.windowMeans[i] > t.windowMeans[i-1]
+	}
+	first, last := t.windowMeans[0], t.windowMeans[len(t.windowMeans)-1]
+	rising = rising && last >= first*trendMinRise
+
+	// Report a trend once, not again for every window it continues.
+	notify := rising && !t.rising
+	t.rising = rising
+	if !notify {
+		return ""
+	}
+	return fmt.Sprintf("latency trending up: mean RTT rose over the last %d summaries from %.0f μs to %.0f μs", trendWindows, first, last)
+}
+
+// runAlertCommand runs command through the shell in the background with
+// the event and message in STUN_TIMING_EVENT and STUN_TIMING_MESSAGE, and
+// any further variables in env.
+func runAlertCommand(command, event, message string, env ...string) {
+	if command == "" {
+		return
+	}
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "STUN_TIMING_EVENT="+event, "STUN_TIMING_MESSAGE="+message)
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to run alert command: %v\n", err)
+		return
+	}
+	go cmd.Wait()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pion/stun"
+)
+
+const stunHeaderSize = 20
+
+var (
+	errTruncated = errors.New("truncated response")
+	errMalformed = errors.New("malformed response")
+)
+
+// classifyRaw checks a received datagram before it reaches pion's parser. A
+// message whose header declares more bytes than were received was truncated
+// in transit; anything else that fails to decode is malformed.
+func classifyRaw(b []byte) error {
+	if len(b) < stunHeaderSize {
+		return errMalformed
+	}
+	if declared := int(binary.BigEndian.Uint16(b[2:4])); stunHeaderSize+declared > len(b) {
+		return errTruncated
+	}
+	m := &stun.Message{Raw: append([]byte(nil), b...)}
+	if err := m.Decode(); err != nil {
+		return errMalformed
+	}
+	return nil
+}
+
+// inspectMaxBad is how many rejected responses an inspectConn remembers.
+// Any request they belong to has long timed out by the time the oldest is
+// forgotten.
+const inspectMaxBad = 1024
+
+// inspectConn wraps the client connection and remembers, by transaction ID,
+// responses that pion would otherwise silently drop as undecodable.
+type inspectConn struct {
+	net.Conn
+
+	mu  sync.Mutex
+	buf []byte
+	bad map[[stun.TransactionIDSize]byte]error
+	// order holds the transaction IDs in bad, oldest first.
+	order [][stun.TransactionIDSize]byte
+}
+
+func newInspectConn(conn net.Conn) *inspectConn {
+	return &inspectConn{
+		Conn: conn,
+		buf:  make([]byte, 64*1024),
+		bad:  make(map[[stun.TransactionIDSize]byte]error),
+	}
+}
+
+func (c *inspectConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(c.buf)
+	if err != nil {
+		return 0, err
+	}
+
+	if n >= stunHeaderSize {
+		if rawErr := classifyRaw(c.buf[:n]); rawErr != nil {
+			var txid [stun.TransactionIDSize]byte
+			copy(txid[:], c.buf[8:stunHeaderSize])
+			c.mu.Lock()
+			c.bad[txid] = rawErr
+			c.order = append(c.order, txid)
+			if len(c.order) > inspectMaxBad {
+				delete(c.bad, c.order[0])
+				c.order = c.order[1:]
+			}
+			c.mu.Unlock()
+		}
+	}
+
+	return copy(b, c.buf[:n]), nil
+}
+
+// responseError returns why the response to txid was rejected, if it was,
+// and forgets it.
+func (c *inspectConn) responseError(txid [stun.TransactionIDSize]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.bad[txid]
+	delete(c.bad, txid)
+	return err
+}
+
+func printTruncation(results []result) {
+	var truncated, malformed int
+	for _, r := range results {
+		switch {
+		case errors.Is(r.err, errTruncated):
+			truncated++
+		case errors.Is(r.err, errMalformed):
+			malformed++
+		}
+	}
+
+	fmt.Printf("\nTruncated responses: %d\n", truncated)
+	fmt.Printf("Malformed responses: %d\n", malformed)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/pion/stun"
+)
+
+func TestClassifyRaw(t *testing.T) {
+	valid := stun.MustBuild(stun.TransactionID, stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: net.IPv4(192, 0, 2, 1), Port: 3478}).Raw
+
+	// A header that declares a 12 byte attribute holding only 4 bytes.
+	badAttr := append([]byte(nil), valid[:stunHeaderSize]...)
+	binary.BigEndian.PutUint16(badAttr[2:4], 4)
+	badAttr = append(badAttr, 0x00, 0x20, 0x00, 0x0c)
+
+	badCookie := append([]byte(nil), valid...)
+	badCookie[4] ^= 0xff
+
+	tests := []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"valid", valid, nil},
+		{"short header", valid[:stunHeaderSize-1], errMalformed},
+		{"empty", nil, errMalformed},
+		{"missing tail", valid[:len(valid)-4], errTruncated},
+		{"header only", valid[:stunHeaderSize], errTruncated},
+		{"attribute overruns message", badAttr, errMalformed},
+		{"bad magic cookie", badCookie, errMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyRaw(tt.b); got != tt.want {
+				t.Errorf("classifyRaw() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
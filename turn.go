@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// turnTransportUDP is the REQUESTED-TRANSPORT protocol number for UDP
+// relays.
+const turnTransportUDP = 17
+
+var (
+	allocateRequest         = stun.NewType(stun.MethodAllocate, stun.ClassRequest)
+	refreshRequest          = stun.NewType(stun.MethodRefresh, stun.ClassRequest)
+	createPermissionRequest = stun.NewType(stun.MethodCreatePermission, stun.ClassRequest)
+	sendIndication          = stun.NewType(stun.MethodSend, stun.ClassIndication)
+	dataIndication          = stun.NewType(stun.MethodData, stun.ClassIndication)
+
+	requestedTransport = stun.RawAttribute{Type: stun.AttrRequestedTransport, Value: []byte{turnTransportUDP, 0, 0, 0}}
+	// zeroLifetime in a Refresh deletes the allocation.
+	zeroLifetime = stun.RawAttribute{Type: stun.AttrLifetime, Value: []byte{0, 0, 0, 0}}
+)
+
+// transact sends m and returns a copy of the response, whatever its class.
+func (p *prober) transact(m *stun.Message) (*stun.Message, error) {
+	var res *stun.Message
+	var resErr error
+	err := p.c.Do(m, func(e stun.Event) {
+		if e.Error != nil {
+			resErr = e.Error
+			return
+		}
+		res = new(stun.Message)
+		e.Message.CloneTo(res)
+	})
+	if err == nil {
+		err = resErr
+	}
+	return res, err
+}
+
+// parseTURNURI returns the host of a turn: or turns: URI and the transport
+// it selects: udp or tcp for turn:, and tls or dtls for turns:.
+func parseTURNURI(raw string) (host, transport string, err error) {
+	u, err := stun.ParseURI(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse TURN URI: %w", err)
+	}
+	switch {
+	case u.Scheme == stun.SchemeTypeTURN && u.Proto == stun.ProtoTypeUDP:
+		transport = "udp"
+	case u.Scheme == stun.SchemeTypeTURN:
+		transport = "tcp"
+	case u.Scheme == stun.SchemeTypeTURNS && u.Proto == stun.ProtoTypeUDP:
+		transport = "dtls"
+	case u.Scheme == stun.SchemeTypeTURNS:
+		transport = "tls"
+	default:
+		return "", "", fmt.Errorf("not a TURN URI: %s", raw)
+	}
+	return net.JoinHostPort(u.Host, strconv.Itoa(u.Port)), transport, nil
+}
+
+// allocate performs one authenticated Allocate and releases the allocation
+// again, returning the time of the Allocate.
+func (p *prober) allocate(creds *longTermCredentials) (time.Duration, error) {
+	_, rtt, err := p.authenticated(creds, allocateRequest, requestedTransport)
+	if err != nil {
+		return rtt, err
+	}
+	if err := p.release(creds); err != nil {
+		return rtt, err
+	}
+	return rtt, nil
+}
+
+func (p *prober) release(creds *longTermCredentials) error {
+	if _, _, err := p.authenticated(creds, refreshRequest, zeroLifetime); err != nil {
+		return fmt.Errorf("failed to release allocation: %w", err)
+	}
+	return nil
+}
+
+// indication is a message received outside any transaction, stamped with
+// when it arrived.
+type indication struct {
+	m        *stun.Message
+	received time.Time
+}
+
+// handleEvent passes indications on to p.indications. Responses without a
+// transaction, such as one that arrived after its request timed out, are
+// only checked against the transaction IDs sent in strict mode.
+func (p *prober) handleEvent(e stun.Event) {
+	if e.Error != nil {
+		return
+	}
+	if e.Message.Type.Class != stun.ClassIndication {
+		if p.txids != nil {
+			p.txids.receive(e.Message)
+		}
+		return
+	}
+	ind := indication{m: new(stun.Message), received: time.Now()}
+	e.Message.CloneTo(ind.m)
+	select {
+	case p.indications <- ind:
+	default:
+	}
+}
+
+// peerAddress is a XOR-PEER-ADDRESS attribute.
+type peerAddress stun.XORMappedAddress
+
+func (a peerAddress) AddTo(m *stun.Message) error {
+	return (*stun.XORMappedAddress)(&a).AddToAs(m, stun.AttrXORPeerAddress)
+}
+
+// relayLoopback allocates a relay, permits its own relayed address as a
+// peer and times cfg.runCount Send indications addressed to that relayed
+// address until the server hands them back as Data indications. Each round
+// trip crosses the relay twice, as media relayed between two peers would.
+func (p *prober) relayLoopback(cfg config, creds *longTermCredentials) ([]result, error) {
+	res, _, err := p.authenticated(creds, allocateRequest, requestedTransport)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(creds)
+
+	var relayed stun.XORMappedAddress
+	if err := relayed.GetFromAs(res, stun.AttrXORRelayedAddress); err != nil {
+		return nil, fmt.Errorf("allocate response has no relayed address: %w", err)
+	}
+	peer := peerAddress(relayed)
+	if _, _, err := p.authenticated(creds, createPermissionRequest, peer); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(cfg.logOutput(), "Starting relay round trips via %s...\n", relayed)
+	bar := cfg.progressBar(cfg.runCount)
+	results := make([]result, cfg.runCount)
+	payload := make([]byte, 8)
+	for i := range results {
+		binary.BigEndian.PutUint64(payload, uint64(i))
+		m := stun.MustBuild(stun.TransactionID, sendIndication, peer,
+			stun.RawAttribute{Type: stun.AttrData, Value: payload}, stun.Fingerprint)
+
+		start := time.Now()
+		results[i] = result{index: i, start: start}
+		if err := p.c.Indicate(m); err != nil {
+			results[i].err = err
+		} else {
+			results[i].err = p.awaitData(payload, start.Add(cfg.timeout), &results[i])
+		}
+		bar.Add(1)
+
+		if cfg.interval > 0 {
+			time.Sleep(cfg.pause())
+		}
+	}
+	fmt.Fprintln(cfg.logOutput())
+	return results, nil
+}
+
+// awaitData waits until deadline for a Data indication carrying payload and
+// records its round-trip time in r. Data for earlier, timed-out sends is
+// skipped.
+func (p *prober) awaitData(payload []byte, deadline time.Time, r *result) error {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		select {
+		case ind := <-p.indications:
+			if ind.m.Type != dataIndication {
+				continue
+			}
+			data, err := ind.m.Get(stun.AttrData)
+			if err != nil || !bytes.Equal(data, payload) {
+				continue
+			}
+			r.time = ind.received.Sub(r.start).Microseconds()
+			return nil
+		case <-timer.C:
+			return stun.ErrTransactionTimeOut
+		}
+	}
+}
+
+// runTURN times Allocate transactions against a TURN server and data relayed
+// through it, and compares them with plain Binding requests to the same
+// server.
+func runTURN(cfg config) error {
+	creds, err := turnCredentialsFor(cfg)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProber(cfg, cfg.stunHost)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	binding, err := p.run(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cfg.logOutput(), "Starting TURN allocations...")
+	bar := cfg.progressBar(cfg.runCount)
+	allocations := make([]result, cfg.runCount)
+	// Over TCP, TLS and DTLS every allocation gets a connection of its own,
+	// as a client setting up a call would, so that connection setup and
+	// handshake are timed alongside each Allocate.
+	connected := cfg.transport != "udp"
+	for i := range allocations {
+		allocations[i] = result{index: i, start: time.Now()}
+		if connected {
+			if err := p.redial(); err != nil {
+				allocations[i].err = err
+				bar.Add(1)
+				continue
+			}
+			allocations[i].connect, allocations[i].handshake = p.setup, p.handshake
+			p.setup, p.handshake = 0, 0
+		}
+		rtt, err := p.allocate(creds)
+		allocations[i].time, allocations[i].err = rtt.Microseconds(), err
+		allocations[i].challenge, p.challenge = p.challenge, 0
+		bar.Add(1)
+	}
+	fmt.Fprintln(cfg.logOutput())
+
+	for _, r := range allocations {
+		if r.err != nil {
+			fmt.Printf("First allocation error: %v\n", r.err)
+			break
+		}
+	}
+	rows := []comparisonRow{
+		{label: "Binding", results: binding},
+		{label: "Allocate", results: allocations},
+	}
+	relay, err := p.relayLoopback(cfg, creds)
+	if err != nil {
+		fmt.Printf("Relay round trips skipped: %v\n", err)
+	} else {
+		rows = append(rows, comparisonRow{label: "Relay", results: relay})
+		for _, r := range relay {
+			if r.err != nil {
+				fmt.Printf("First relay error: %v\n", r.err)
+				break
+			}
+		}
+	}
+
+	fmt.Println()
+	printComparison(rows)
+	if connected {
+		printConnectSetup(allocations, cfg.transport)
+	}
+	printChallenges(allocations)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTURNTTL is how long credentials computed from -turn-secret are
+// valid for.
+const defaultTURNTTL = time.Hour
+
+// turnRESTResponse is the body returned by a TURN REST API endpoint, as
+// described in draft-uberti-behave-turn-rest and served by coturn
+// deployments.
+type turnRESTResponse struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	TTL      int64    `json:"ttl"`
+	URIs     []string `json:"uris"`
+}
+
+// ephemeralCredentials computes time-limited credentials from a secret
+// shared with the TURN server, the way coturn's use-auth-secret expects: the
+// username is the expiry time followed by the user, and the password is the
+// base64 HMAC-SHA1 of the username.
+func ephemeralCredentials(secret, user string, expires time.Time) *longTermCredentials {
+	username := strconv.FormatInt(expires.Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return &longTermCredentials{
+		username: username,
+		password: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+// fetchTURNCredentials asks a TURN REST API endpoint for credentials. The
+// service and username query parameters are added unless endpoint already
+// has them.
+func fetchTURNCredentials(endpoint, user string) (*longTermCredentials, time.Duration, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid TURN REST URL: %w", err)
+	}
+	q := u.Query()
+	if !q.Has("service") {
+		q.Set("service", "turn")
+	}
+	if user != "" && !q.Has("username") {
+		q.Set("username", user)
+	}
+	u.RawQuery = q.Encode()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch TURN credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("TURN credential request failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var body turnRESTResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode TURN credentials: %w", err)
+	}
+	if body.Username == "" || body.Password == "" {
+		return nil, 0, errors.New("TURN credential response has no username or password")
+	}
+	return &longTermCredentials{username: body.Username, password: body.Password}, time.Duration(body.TTL) * time.Second, nil
+}
+
+// turnCredentialsFor returns the credentials the TURN mode authenticates
+// with: fetched from -turn-rest-url, computed from -turn-secret, or the
+// static -turn-user and -turn-pass.
+func turnCredentialsFor(cfg config) (*longTermCredentials, error) {
+	switch {
+	case cfg.turnRESTURL != "":
+		creds, ttl, err := fetchTURNCredentials(cfg.turnRESTURL, cfg.turnUser)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(cfg.logOutput(), "Fetched TURN credentials for %s (valid for %s)\n", creds.username, ttl)
+		return creds, nil
+	case cfg.turnSecret != "":
+		return ephemeralCredentials(cfg.turnSecret, cfg.turnUser, time.Now().Add(cfg.turnTTL)), nil
+	case cfg.turnUser == "" || cfg.turnPass == "":
+		return nil, errors.New("-turn needs -turn-user and -turn-pass, -turn-secret or -turn-rest-url")
+	}
+	return &longTermCredentials{username: cfg.turnUser, password: cfg.turnPass}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// runVPNComparison measures the same server through two interfaces, normally
+// a VPN tunnel and the bare uplink, and reports the latency the VPN adds.
+func runVPNComparison(cfg config) error {
+	ifaces := strings.Split(cfg.vpnCompare, ",")
+	if len(ifaces) != 2 || ifaces[0] == "" || ifaces[1] == "" {
+		return fmt.Errorf("-vpn-compare wants two interfaces, vpn,bare (got %q)", cfg.vpnCompare)
+	}
+
+	var rows []comparisonRow
+	for _, iface := range ifaces {
+		ifCfg := cfg
+		ifCfg.iface = iface
+		results, err := runSTUNRequests(ifCfg, cfg.stunHost)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", iface, err)
+		}
+		rows = append(rows, comparisonRow{label: iface, results: results})
+	}
+
+	fmt.Println()
+	printComparison(rows)
+
+	vpnTimes, bareTimes := sortedSuccessfulTimes(rows[0].results), sortedSuccessfulTimes(rows[1].results)
+	if len(vpnTimes) == 0 || len(bareTimes) == 0 {
+		fmt.Println("\nNot enough successful requests to compute VPN overhead")
+		return nil
+	}
+
+	fmt.Printf("\nVPN overhead (%s vs %s):\n", ifaces[0], ifaces[1])
+	for _, p := range []float64{50, 75, 100} {
+		fmt.Printf("  %-4s %+d μs\n", percentileLabel(p), percentile(vpnTimes, p)-percentile(bareTimes, p))
+	}
+	return nil
+}
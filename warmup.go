@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// warmUp sends cfg.warmup Binding requests, built like the measured ones, on
+// the prober's socket and discards their results, so that ARP/NDP
+// resolution, conntrack and NAT state setup, any connection handshake and
+// the nonce round trip are out of the way before the measured requests. It
+// returns how many got a success response and the RTT of the first of them.
+func (p *prober) warmUp(cfg config) (int, time.Duration, error) {
+	answered := 0
+	var first time.Duration
+	for i := 0; i < cfg.warmup; i++ {
+		message, err := p.bindingRequest(cfg, i)
+		if err != nil {
+			return 0, 0, err
+		}
+		if p.txids != nil {
+			p.txids.send(message.TransactionID)
+		}
+		start := time.Now()
+		ok := false
+		err = p.c.Do(message, func(res stun.Event) {
+			if res.Error != nil {
+				return
+			}
+			if res.Message.Type.Class == stun.ClassErrorResponse {
+				// A stale nonce is replaced for the next request.
+				if cfg.auth != nil {
+					cfg.auth.challenge(res.Message)
+				}
+				return
+			}
+			ok = true
+		})
+		if err != nil || !ok {
+			continue
+		}
+		if answered == 0 {
+			first = time.Since(start)
+		}
+		answered++
+	}
+	// The warm-up paid for the connection and the nonce, not the first
+	// measured request.
+	p.setup, p.handshake, p.challenge = 0, 0, 0
+	return answered, first, nil
+}
+
+// printWarmUp reports the warm-up requests that are left out of the
+// statistics.
+func printWarmUp(cfg config, n, answered int, first time.Duration) {
+	out := cfg.logOutput()
+	if answered == 0 {
+		fmt.Fprintf(out, "Warm-up: none of %d requests answered (excluded from statistics)\n", n)
+		return
+	}
+	fmt.Fprintf(out, "Warm-up: %d of %d requests answered, first in %d μs (excluded from statistics)\n", answered, n, first.Microseconds())
+}